@@ -0,0 +1,139 @@
+/*
+Package assets serves the files in static/ under fingerprinted URLs.
+
+At startup InitAssets hashes every file, so static/css/stylesheet.css is also
+served as /static/css/stylesheet-1a2b3c4d.css. Because that URL changes with
+the content, browsers may cache it forever; Path returns it, and templates
+get it from the asset helper. The plain URLs still work and answer with an
+ETag, so browsers revalidate them and get 304 Not Modified when nothing
+changed.
+*/
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Prefix is the URL path static files are served under.
+	Prefix = "/static/"
+	// root is the directory of the static files in the file system.
+	root = "static"
+)
+
+// asset is a static file and its content hash.
+type asset struct {
+	file   string
+	digest string
+}
+
+var (
+	mu    sync.RWMutex
+	files fs.FS
+	// fingerprinted maps a file's name under static/ to its fingerprinted
+	// name, e.g. "css/stylesheet.css" to "css/stylesheet-1a2b3c4d.css".
+	fingerprinted map[string]string
+	// byName maps both names of every file to it.
+	byName map[string]asset
+	// immutable holds the fingerprinted names.
+	immutable map[string]bool
+)
+
+// InitAssets hashes the files under static/ in fsys, normally the embed.FS
+// from main.go.
+func InitAssets(fsys fs.FS) {
+	fp := make(map[string]string)
+	names := make(map[string]asset)
+	imm := make(map[string]bool)
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		a := asset{file: p, digest: hex.EncodeToString(sum[:4])}
+		name := strings.TrimPrefix(p, root+"/")
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "-" + a.digest + ext
+		fp[name] = hashed
+		names[name] = a
+		names[hashed] = a
+		imm[hashed] = true
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("hashing static files failed", "error", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	files, fingerprinted, byName, immutable = fsys, fp, names, imm
+}
+
+// Path returns the URL of a file in static/: its fingerprinted URL if
+// InitAssets saw it, the plain one otherwise.
+func Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	mu.RLock()
+	hashed, ok := fingerprinted[name]
+	mu.RUnlock()
+	if ok {
+		return Prefix + hashed
+	}
+	return Prefix + name
+}
+
+// Handler serves the static files under Prefix. Fingerprinted URLs are
+// cached for a year as immutable; plain ones must be revalidated with their
+// ETag.
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, Prefix)
+	mu.RLock()
+	a, ok := byName[name]
+	fsys, imm := files, immutable[name]
+	mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := fsys.Open(a.file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	if imm {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", `"`+a.digest+`"`)
+	// ServeContent answers If-None-Match with 304 using the ETag.
+	http.ServeContent(w, r, a.file, time.Time{}, content)
+}
@@ -0,0 +1,58 @@
+package assets
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+func get(path string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestAssets(t *testing.T) {
+	InitAssets(fstest.MapFS{
+		"static/css/stylesheet.css": {Data: []byte("body { color: red }")},
+	})
+
+	url := Path("css/stylesheet.css")
+	if !regexp.MustCompile(`^/static/css/stylesheet-[0-9a-f]{8}\.css$`).MatchString(url) {
+		t.Fatalf("unexpected fingerprinted path %s", url)
+	}
+	if got := Path("/css/missing.css"); got != "/static/css/missing.css" {
+		t.Errorf("unknown files keep their path, got %s", got)
+	}
+
+	w := get(url)
+	if w.Code != 200 || w.Body.String() != "body { color: red }" {
+		t.Fatalf("fingerprinted: %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("fingerprinted Cache-Control %q", cc)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type %q", ct)
+	}
+
+	w = get("/static/css/stylesheet.css")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("plain: %d, ETag %q, Cache-Control %q", w.Code, etag, w.Header().Get("Cache-Control"))
+	}
+	if w = get("/static/css/stylesheet.css", "If-None-Match", etag); w.Code != 304 {
+		t.Errorf("expected 304 for a matching ETag, got %d", w.Code)
+	}
+
+	for _, p := range []string{"/static/css/stylesheet-00000000.css", "/static/css/", "/static/../go.mod"} {
+		if w = get(p); w.Code != 404 {
+			t.Errorf("%s: expected 404, got %d", p, w.Code)
+		}
+	}
+}
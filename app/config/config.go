@@ -27,12 +27,32 @@ var SECRET_KEY = os.Getenv("SECRET_KEY")
 
 var MONOLITH_VERSION = "0.1.0"
 
+// APP_ENV is "development" or "production" (the default). Development reloads
+// templates from disk and shows detailed error pages.
+var APP_ENV = os.Getenv("APP_ENV")
+
+// Set WS_BACKPLANE=true when running more than one app process against the
+// same database so WebSocket broadcasts reach clients on every process.
+var WS_BACKPLANE = os.Getenv("WS_BACKPLANE") == "true"
+
+// Set WS_COMPRESSION=true to offer permessage-deflate to WebSocket clients.
+var WS_COMPRESSION = os.Getenv("WS_COMPRESSION") == "true"
+
+// IsDevelopment reports whether the app runs with APP_ENV=development.
+func IsDevelopment() bool {
+	return APP_ENV == "development"
+}
+
 func InitConfig() {
 	// log warnings if secret key and other environment variables are not set
 	if SECRET_KEY == "" {
 		slog.Warn("SECRET_KEY is not set, using default value. This is insecure for production use.")
 		SECRET_KEY = "default_secret_key"
 	}
+	if APP_ENV == "" {
+		slog.Info("APP_ENV is not set, using default value: production")
+		APP_ENV = "production"
+	}
 	if PORT == "" {
 		slog.Info("PORT is not set, using default value: 9000")
 		PORT = "9000"
@@ -11,6 +11,5 @@ var ErrorCtrl = &ErrorController{}
 
 // Show404 renders the 404 page with a 404 status code.
 func (ec *ErrorController) Show404(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	views.Render(w, "404.html.tmpl", nil)
+	views.HTML(w, r, http.StatusNotFound, "404.html.tmpl", nil)
 }
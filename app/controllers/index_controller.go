@@ -21,5 +21,5 @@ func (ic *IndexController) ShowIndex(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"monolith_version": config.MONOLITH_VERSION,
 	}
-	views.Render(w, "index.html.tmpl", data)
+	views.HTML(w, r, http.StatusOK, "index.html.tmpl", data)
 }
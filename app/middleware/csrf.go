@@ -30,3 +30,14 @@ func CrossOriginProtector() *http.CrossOriginProtection {
 func CSRFMiddleware(next http.Handler) http.Handler {
 	return crossOriginProtector.Handler(next)
 }
+
+// CheckOrigin reports whether r comes from the same origin or from one trusted
+// on CrossOriginProtector(). It applies the rules CSRFMiddleware uses for
+// unsafe methods to any request, which suits WebSocket upgrades: they are GET
+// requests, so CSRFMiddleware lets them through, but browsers send them with
+// cookies from any page.
+func CheckOrigin(r *http.Request) bool {
+	probe := r.Clone(r.Context())
+	probe.Method = http.MethodPost
+	return crossOriginProtector.Check(probe) == nil
+}
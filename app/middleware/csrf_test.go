@@ -63,3 +63,40 @@ func TestCSRFMiddlewareAllowsSafeMethods(t *testing.T) {
 		t.Fatalf("handler not called")
 	}
 }
+
+func TestCheckOrigin(t *testing.T) {
+	protector := newCrossOriginProtector()
+	if err := protector.AddTrustedOrigin("https://trusted.test"); err != nil {
+		t.Fatal(err)
+	}
+	saved := crossOriginProtector
+	crossOriginProtector = protector
+	defer func() { crossOriginProtector = saved }()
+
+	cases := []struct {
+		origin, site string
+		want         bool
+	}{
+		{"https://example.com", "same-origin", true},
+		{"https://attacker.test", "cross-site", false},
+		{"https://trusted.test", "cross-site", true},
+		{"https://example.com", "", true},
+		{"https://attacker.test", "", false},
+		{"", "", true}, // not a browser
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/ws", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.site != "" {
+			req.Header.Set("Sec-Fetch-Site", c.site)
+		}
+		if got := CheckOrigin(req); got != c.want {
+			t.Errorf("CheckOrigin(origin=%q, site=%q) = %v, want %v", c.origin, c.site, got, c.want)
+		}
+		if req.Method != http.MethodGet {
+			t.Fatalf("CheckOrigin modified the request")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"monolith/app/views"
+)
+
+// FormatMiddleware lets a URL pick its response format with a suffix, so
+// GET /widgets/1.json is routed as GET /widgets/1 and answered with JSON by
+// views.Respond. The suffixes are views.Suffixes; files under /static/ keep
+// their names.
+func FormatMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ext := path.Ext(r.URL.Path)
+		f, ok := views.Suffixes[ext]
+		if !ok || path.Base(r.URL.Path) == ext {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = views.WithFormat(r, f)
+		u := *r.URL
+		u.Path = strings.TrimSuffix(u.Path, ext)
+		u.RawPath = strings.TrimSuffix(u.RawPath, ext)
+		r.URL = &u
+		next.ServeHTTP(w, r)
+	})
+}
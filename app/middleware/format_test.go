@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"monolith/app/views"
+)
+
+func TestFormatMiddleware(t *testing.T) {
+	var path string
+	var format views.Format
+	handler := FormatMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, format = r.URL.Path, views.RequestFormat(r)
+	}))
+	tests := []struct {
+		url    string
+		path   string
+		format views.Format
+	}{
+		{"/widgets/1.json", "/widgets/1", views.FormatJSON},
+		{"/widgets.json?page=2", "/widgets", views.FormatJSON},
+		{"/widgets/1", "/widgets/1", views.FormatHTML},
+		{"/static/data.json", "/static/data.json", views.FormatHTML},
+		{"/widgets/1.txt", "/widgets/1.txt", views.FormatHTML},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		original := req.URL.Path
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if path != tt.path || format != tt.format {
+			t.Errorf("%s: got %s %v, want %s %v", tt.url, path, format, tt.path, tt.format)
+		}
+		if req.URL.Path != original {
+			t.Errorf("%s: the original request was changed to %s", tt.url, req.URL.Path)
+		}
+	}
+}
@@ -18,3 +18,15 @@ func TestLoggingMiddleware(t *testing.T) {
 		t.Fatalf("unexpected body %q", body)
 	}
 }
+
+func TestLoggingMiddlewareKeepsWriterFeatures(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Errorf("wrapped writer can't be hijacked")
+		}
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("wrapped writer can't flush: %v", err)
+		}
+	})
+	LoggingMiddleware(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
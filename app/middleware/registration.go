@@ -7,6 +7,7 @@ import "net/http"
 var registrationMiddleware = []func(http.Handler) http.Handler{
 	LoggingMiddleware,
 	CSRFMiddleware,
+	FormatMiddleware,
 }
 
 func GetAllRegisteredMiddleware() []func(http.Handler) http.Handler {
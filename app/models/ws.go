@@ -4,9 +4,18 @@ import "time"
 
 // Message is the GORM model used to store incoming messages used by web sockets.
 type Message struct {
-	ID        uint `gorm:"primaryKey"`
-	IsActive  bool `gorm:"default:true"`
-	Channel   string
-	Content   string
+	ID       uint `gorm:"primaryKey"`
+	IsActive bool `gorm:"default:true"`
+	Channel  string
+	Content  string
+	// Binary messages hold base64-encoded bytes in Content.
+	Binary bool
+	// JSON messages hold a JSON value in Content; others hold text.
+	JSON bool
+	// Stream messages are live page updates broadcast by the server.
+	Stream    bool
 	CreatedAt time.Time
+	// Origin identifies the process that broadcast the message, so hubs
+	// sharing the database don't deliver their own messages twice.
+	Origin string `gorm:"index"`
 }
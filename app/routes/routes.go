@@ -2,6 +2,7 @@ package routes
 
 import (
 	"embed"
+	"monolith/app/assets"
 	"monolith/app/controllers"
 	"monolith/app/middleware"
 	"monolith/ws"
@@ -15,20 +16,21 @@ func InitServerHandler(staticFiles embed.FS) http.Handler {
 	// Register all routes
 	registerRoutes(mux, staticFiles)
 
-	// apply all registered middleware
+	// apply all registered middleware, the first one outermost
 	middlewares := middleware.GetAllRegisteredMiddleware()
-	var handler http.Handler
-	for _, m := range middlewares {
-		handler = m(mux)
+	var handler http.Handler = mux
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
 	}
 
 	return handler
 }
 
 func registerRoutes(mux *http.ServeMux, staticFiles embed.FS) {
-	// Serve static files from embedded filesystem
-	staticFileServer := http.FileServer(http.FS(staticFiles))
-	mux.Handle("GET /static/", staticFileServer)
+	// Serve static files from embedded filesystem, hashed once at startup
+	// for fingerprinted URLs
+	assets.InitAssets(staticFiles)
+	mux.Handle("GET "+assets.Prefix, assets.Handler())
 
 	mux.HandleFunc("GET /", controllers.IndexCtrl.ShowIndex)
 
@@ -37,4 +39,7 @@ func registerRoutes(mux *http.ServeMux, staticFiles embed.FS) {
 		ws.ServeWs(w, r)
 	})
 
+	// stream the same pub/sub channels as Server-Sent Events at "/events"
+	mux.HandleFunc("GET /events", ws.ServeSSE)
+
 }
@@ -4,12 +4,17 @@ import (
 	"embed"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+
+	"monolith/app/views"
 )
 
 func TestRandomRouteNotFound(t *testing.T) {
 	// zero-value embed.FS provides an empty filesystem for static files
 	handler := InitServerHandler(embed.FS{})
+	// the 404 page is a template, read from the project root
+	views.InitTemplates(os.DirFS("../.."))
 
 	req := httptest.NewRequest(http.MethodGet, "/does-not-exist", nil)
 	w := httptest.NewRecorder()
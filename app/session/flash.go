@@ -0,0 +1,103 @@
+package session
+
+import (
+	"encoding/gob"
+	"net/http"
+)
+
+const FLASH_KEY = "flash"
+
+// Flash levels. Any string works as a level; these are the ones the
+// generators and the flash partial use.
+const (
+	FlashNotice = "notice"
+	FlashAlert  = "alert"
+)
+
+// Flash is a message for the next page the user sees, such as "Saved!"
+// after a redirect.
+type Flash struct {
+	Level   string
+	Message string
+}
+
+func init() {
+	// session values are gob encoded into the cookie
+	gob.Register([]Flash{})
+}
+
+// SetFlash adds a message to show on the next page rendered for this
+// session, usually right before a redirect.
+func SetFlash(w http.ResponseWriter, r *http.Request, level, message string) error {
+	return KeepFlashes(w, r, Flash{Level: level, Message: message})
+}
+
+// KeepFlashes puts messages back into the session, e.g. ones read with
+// Flashes that should still be shown after another redirect.
+func KeepFlashes(w http.ResponseWriter, r *http.Request, flashes ...Flash) error {
+	s, err := GetSession(r)
+	if err != nil {
+		return err
+	}
+	waiting, _ := s.Values[FLASH_KEY].([]Flash)
+	s.Values[FLASH_KEY] = append(waiting, flashes...)
+	return s.Save(r, w)
+}
+
+// Flashes returns the messages waiting for this session and removes them,
+// so each is shown once. With levels it reads only messages of those
+// levels and leaves the others waiting.
+func Flashes(w http.ResponseWriter, r *http.Request, levels ...string) []Flash {
+	s, err := GetSession(r)
+	if err != nil {
+		return nil
+	}
+	waiting, _ := s.Values[FLASH_KEY].([]Flash)
+	if len(waiting) == 0 {
+		return nil
+	}
+	read, kept := splitFlashes(waiting, levels)
+	if len(kept) == 0 {
+		delete(s.Values, FLASH_KEY)
+	} else {
+		s.Values[FLASH_KEY] = kept
+	}
+	if err := s.Save(r, w); err != nil {
+		return nil
+	}
+	return read
+}
+
+// PeekFlashes is Flashes without removing the messages.
+func PeekFlashes(r *http.Request, levels ...string) []Flash {
+	s, err := GetSession(r)
+	if err != nil {
+		return nil
+	}
+	waiting, _ := s.Values[FLASH_KEY].([]Flash)
+	read, _ := splitFlashes(waiting, levels)
+	return read
+}
+
+// splitFlashes separates the messages of levels, or all messages if levels
+// is empty, from the rest.
+func splitFlashes(flashes []Flash, levels []string) (match, rest []Flash) {
+	if len(levels) == 0 {
+		return flashes, nil
+	}
+	for _, f := range flashes {
+		wanted := false
+		for _, l := range levels {
+			if f.Level == l {
+				wanted = true
+				break
+			}
+		}
+		if wanted {
+			match = append(match, f)
+		} else {
+			rest = append(rest, f)
+		}
+	}
+	return match, rest
+}
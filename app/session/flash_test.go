@@ -0,0 +1,55 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"monolith/app/config"
+)
+
+// next is a request carrying the session cookie of response w, which has
+// one Set-Cookie per save; like a browser it keeps the last.
+func next(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	cookies := w.Result().Cookies()
+	r.AddCookie(cookies[len(cookies)-1])
+	return r
+}
+
+func TestFlashes(t *testing.T) {
+	config.SECRET_KEY = "test"
+	InitSession()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/widgets", nil)
+	SetFlash(w, r, FlashNotice, "Saved!")
+	SetFlash(w, r, FlashAlert, "Careful")
+
+	r = next(w)
+	if got := PeekFlashes(r); len(got) != 2 {
+		t.Fatalf("expected both messages waiting, got %v", got)
+	}
+	w = httptest.NewRecorder()
+	alerts := Flashes(w, r, FlashAlert)
+	if len(alerts) != 1 || alerts[0].Message != "Careful" {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+
+	r = next(w)
+	w = httptest.NewRecorder()
+	rest := Flashes(w, r)
+	if len(rest) != 1 || rest[0] != (Flash{Level: FlashNotice, Message: "Saved!"}) {
+		t.Fatalf("unexpected flashes %v", rest)
+	}
+	KeepFlashes(w, r, rest...)
+
+	r = next(w)
+	w = httptest.NewRecorder()
+	if got := Flashes(w, r); len(got) != 1 {
+		t.Fatalf("kept message is gone: %v", got)
+	}
+	if got := Flashes(httptest.NewRecorder(), next(w)); len(got) != 0 {
+		t.Fatalf("messages shown twice: %v", got)
+	}
+}
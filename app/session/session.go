@@ -1,6 +1,7 @@
 package session
 
 import (
+	"errors"
 	"monolith/app/config"
 	"net/http"
 
@@ -20,5 +21,25 @@ func InitSession() {
 
 // GetSession retrieves the session from the request
 func GetSession(r *http.Request) (*sessions.Session, error) {
+	if store == nil {
+		return nil, errors.New("session: InitSession has not been called")
+	}
 	return store.Get(r, SESSION_NAME_KEY)
 }
+
+// LoggedInEmail returns the email of the logged in user, or "" if nobody is
+// logged in.
+func LoggedInEmail(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	s, err := GetSession(r)
+	if err != nil {
+		return ""
+	}
+	if loggedIn, _ := s.Values[LOGGED_IN_KEY].(bool); !loggedIn {
+		return ""
+	}
+	email, _ := s.Values[EMAIL_KEY].(string)
+	return email
+}
@@ -0,0 +1,319 @@
+package views
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"monolith/app/assets"
+	"monolith/app/session"
+
+	"github.com/jinzhu/inflection"
+)
+
+// Every template can use these functions:
+//
+//	{{.CreatedAt | date}}                  Jan 2, 2006
+//	{{.CreatedAt | datetime}}              Jan 2, 2006 3:04 PM
+//	{{.CreatedAt | formatTime "2006-01-02"}}
+//	{{.CreatedAt | timeAgo}}               5 minutes ago
+//	{{number 1234567}}                     1,234,567
+//	{{.Price | decimal 2}}                 1,234.50
+//	{{pluralize .Count "comment"}}         3 comments
+//	{{.Body | truncate 100}}               first 100 characters and "…"
+//	{{dict "title" .Title "page" .Page}}   a map, e.g. for partial data
+//	{{list "a" "b"}}                       a slice
+//	{{safeHTML .Trusted}}                  HTML that is not escaped
+//	{{markdown .Body}}                     Markdown rendered to HTML
+//	{{asset "css/stylesheet.css"}}         /static/css/stylesheet-1a2b3c4d.css
+//	{{url "/widgets/{id}/edit" .ID}}       /widgets/42/edit
+//	{{request}}                            the *http.Request, see WithRequest
+//	{{currentUser}}                        see CurrentUser
+//	{{range flash}}{{.Message}}{{end}}     see Flash; {{flash "alert"}} for one level
+//	{{partial "widgets/form" .}}           a partial, see tmpl.go
+var builtinFuncs = template.FuncMap{
+	"date":       func(t interface{}) string { return formatTime("Jan 2, 2006", t) },
+	"datetime":   func(t interface{}) string { return formatTime("Jan 2, 2006 3:04 PM", t) },
+	"formatTime": formatTime,
+	"timeAgo":    timeAgo,
+	"number":     number,
+	"decimal":    decimal,
+	"pluralize":  pluralize,
+	"truncate":   truncate,
+	"dict":       dict,
+	"list":       list,
+	"safeHTML":   func(s string) template.HTML { return template.HTML(s) },
+	"markdown":   Markdown,
+	"asset":      AssetPath,
+	"url":        URL,
+}
+
+// appFuncs holds the functions registered with Funcs.
+var appFuncs = template.FuncMap{}
+
+// Funcs adds functions for templates to use, replacing built-in ones of the
+// same name. Call it before InitTemplates.
+func Funcs(funcs template.FuncMap) {
+	for name, fn := range funcs {
+		appFuncs[name] = fn
+	}
+}
+
+// CurrentUser returns what the currentUser helper shows for a request. The
+// default is the logged in user's email, or nil. Replace it during startup
+// to return your own user model.
+var CurrentUser = func(r *http.Request) interface{} {
+	if email := session.LoggedInEmail(r); email != "" {
+		return email
+	}
+	return nil
+}
+
+// Flash returns the flash messages for a request, which the flash helper
+// shows. The default reads them from the session (see session.SetFlash):
+// pages sent by HTML or Respond remove them so each is shown once, other
+// renders (w is nil) leave them waiting.
+var Flash = func(w http.ResponseWriter, r *http.Request) []session.Flash {
+	if r == nil {
+		return nil
+	}
+	if w == nil {
+		return session.PeekFlashes(r)
+	}
+	return session.Flashes(w, r)
+}
+
+// AssetPath returns the fingerprinted URL of a file in static/, which the
+// asset helper uses; see package assets.
+func AssetPath(name string) string {
+	return assets.Path(name)
+}
+
+// routes holds the patterns named with Route.
+var routes = map[string]string{}
+
+// Route names a route pattern so templates can build its URL with
+// {{url "name" ...}}. Call it during startup.
+func Route(name, pattern string) {
+	routes[name] = pattern
+}
+
+// URL builds a path from a route name or a ServeMux pattern such as
+// "GET /widgets/{id}". params fill the pattern's wildcards in order; any
+// left over are key/value pairs added as the query string.
+func URL(route string, params ...interface{}) (string, error) {
+	pattern := route
+	if p, ok := routes[route]; ok {
+		pattern = p
+	}
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = pattern[i+1:]
+	}
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(pattern, '{')
+		if open < 0 {
+			b.WriteString(pattern)
+			break
+		}
+		end := strings.IndexByte(pattern[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("url %q: unclosed wildcard", route)
+		}
+		b.WriteString(pattern[:open])
+		name := pattern[open+1 : open+end]
+		pattern = pattern[open+end+1:]
+		if name == "$" {
+			continue
+		}
+		if len(params) == 0 {
+			return "", fmt.Errorf("url %q: missing value for {%s}", route, name)
+		}
+		value := fmt.Sprint(params[0])
+		params = params[1:]
+		if strings.HasSuffix(name, "...") {
+			segments := strings.Split(value, "/")
+			for i, s := range segments {
+				segments[i] = url.PathEscape(s)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+	}
+	if len(params) > 0 {
+		if len(params)%2 != 0 {
+			return "", fmt.Errorf("url %q: query parameters must be key/value pairs", route)
+		}
+		query := url.Values{}
+		for i := 0; i < len(params); i += 2 {
+			query.Add(fmt.Sprint(params[i]), fmt.Sprint(params[i+1]))
+		}
+		b.WriteString("?" + query.Encode())
+	}
+	return b.String(), nil
+}
+
+// toTime accepts a time.Time or *time.Time.
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, !t.IsZero()
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, false
+		}
+		return *t, !t.IsZero()
+	}
+	return time.Time{}, false
+}
+
+// formatTime formats t with a time.Format layout, or returns "" for a zero
+// or missing time.
+func formatTime(layout string, t interface{}) string {
+	tt, ok := toTime(t)
+	if !ok {
+		return ""
+	}
+	return tt.Format(layout)
+}
+
+// timeAgo describes t relative to now: "just now", "5 minutes ago",
+// "in 2 days".
+func timeAgo(t interface{}) string {
+	tt, ok := toTime(t)
+	if !ok {
+		return ""
+	}
+	d := time.Since(tt)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	var n int64
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int64(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int64(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		n, unit = int64(d/(24*time.Hour)), "day"
+	case d < 365*24*time.Hour:
+		n, unit = int64(d/(30*24*time.Hour)), "month"
+	default:
+		n, unit = int64(d/(365*24*time.Hour)), "year"
+	}
+	s, _ := pluralize(n, unit)
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// toFloat converts any integer or float to a float64.
+func toFloat(v interface{}) (float64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("%v (%T) is not a number", v, v)
+}
+
+// number formats an integer, or a float with as many decimals as it needs,
+// with thousands separators.
+func number(v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return groupThousands(strconv.FormatFloat(f, 'f', -1, 64)), nil
+}
+
+// decimal formats a number with places decimals and thousands separators.
+func decimal(places int, v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return groupThousands(strconv.FormatFloat(f, 'f', places, 64)), nil
+}
+
+func groupThousands(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i:]
+	}
+	var b strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String() + frac
+}
+
+// pluralize returns count followed by word, pluralized unless count is 1.
+func pluralize(count interface{}, word string) (string, error) {
+	f, err := toFloat(count)
+	if err != nil {
+		return "", err
+	}
+	n := strconv.FormatFloat(f, 'f', -1, 64)
+	if math.Abs(f) == 1 {
+		return n + " " + word, nil
+	}
+	return n + " " + inflection.Plural(word), nil
+}
+
+// truncate shortens s to at most n characters, ending with "…" when it had
+// to cut.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(runes[:max(n, 0)])
+	}
+	return strings.TrimRight(string(runes[:n-1]), " ") + "…"
+}
+
+// dict builds a map from key/value pairs.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict expects key/value pairs, got %d arguments", len(pairs))
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// list builds a slice from its arguments.
+func list(items ...interface{}) []interface{} {
+	return items
+}
@@ -0,0 +1,113 @@
+package views
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"monolith/app/session"
+)
+
+func TestHelpers(t *testing.T) {
+	created := time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		tmpl string
+		data interface{}
+		want string
+	}{
+		{`{{. | date}}`, created, "Mar 5, 2024"},
+		{`{{. | datetime}}`, &created, "Mar 5, 2024 2:30 PM"},
+		{`{{. | formatTime "2006-01-02"}}`, created, "2024-03-05"},
+		{`{{. | date}}`, time.Time{}, ""},
+		{`{{. | timeAgo}}`, time.Now().Add(-3 * time.Hour), "3 hours ago"},
+		{`{{. | timeAgo}}`, time.Now().Add(49 * time.Hour), "in 2 days"},
+		{`{{number .}}`, 1234567, "1,234,567"},
+		{`{{number .}}`, -1234.5, "-1,234.5"},
+		{`{{. | decimal 2}}`, 1234.5, "1,234.50"},
+		{`{{pluralize . "comment"}}`, 1, "1 comment"},
+		{`{{pluralize . "person"}}`, 3, "3 people"},
+		{`{{. | truncate 8}}`, "Hello, world", "Hello,…"},
+		{`{{. | truncate 20}}`, "Hello, world", "Hello, world"},
+		{`{{with dict "a" 1 "b" (list 2 3)}}{{.a}} {{index .b 1}}{{end}}`, nil, "1 3"},
+		{`{{safeHTML .}}`, "<b>hi</b>", "<b>hi</b>"},
+		{`{{.}}`, "<b>hi</b>", "&lt;b&gt;hi&lt;/b&gt;"},
+		{`{{asset "css/stylesheet.css"}}`, nil, "/static/css/stylesheet.css"},
+		{`{{url "GET /widgets/{id}/edit" .}}`, 42, "/widgets/42/edit"},
+		{`{{url "/files/{path...}" "a b/c" "page" 2}}`, nil, "/files/a%20b/c?page=2"},
+		{`{{url "/{$}"}}`, nil, "/"},
+	}
+	for _, tt := range tests {
+		tmpl := template.Must(template.New("").Funcs(builtinFuncs).Parse(tt.tmpl))
+		var b strings.Builder
+		if err := tmpl.Execute(&b, tt.data); err != nil {
+			t.Errorf("%s: %v", tt.tmpl, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+
+	if _, err := URL("/widgets/{id}"); err == nil {
+		t.Errorf("expected an error for a missing wildcard value")
+	}
+	Route("widget", "GET /widgets/{id}")
+	if got, _ := URL("widget", 7); got != "/widgets/7" {
+		t.Errorf("named route: got %q", got)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	src := "# Title\n\nSome *em*, **strong**, `<code>` and snake_case_name.\n" +
+		"A [link](https://example.com) and [bad](javascript:alert(1)).\n\n" +
+		"- one\n- two\n\n1. first\n\n> quoted\n\n```go\nx := <y>\n```\n\n---\n<script>"
+	want := "<h1>Title</h1>\n" +
+		"<p>Some <em>em</em>, <strong>strong</strong>, <code>&lt;code&gt;</code> and snake_case_name.<br>\n" +
+		"A <a href=\"https://example.com\">link</a> and bad).</p>\n" +
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<ol>\n<li>first</li>\n</ol>\n" +
+		"<blockquote>\n<p>quoted</p>\n</blockquote>\n" +
+		"<pre><code class=\"language-go\">x := &lt;y&gt;</code></pre>\n<hr>\n<p>&lt;script&gt;</p>\n"
+	if got := string(Markdown(src)); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRequestHelpersAndAppFuncs(t *testing.T) {
+	Funcs(template.FuncMap{"shout": strings.ToUpper})
+	defer delete(appFuncs, "shout")
+	defer func(fn func(*http.Request) interface{}) { CurrentUser = fn }(CurrentUser)
+	CurrentUser = func(r *http.Request) interface{} { return r.Header.Get("X-User") }
+
+	InitTemplates(fstest.MapFS{
+		"app/views/page.html.tmpl": {Data: []byte(`{{shout "hi"}} {{request.URL.Path}} {{currentUser}}`)},
+	})
+	r := httptest.NewRequest("GET", "/about", nil)
+	r.Header.Set("X-User", "ada")
+	if got := render(t, "page.html.tmpl", nil, WithRequest(r)); got != "HI /about ada" {
+		t.Fatalf("unexpected render %q", got)
+	}
+}
+
+func TestFlashHelper(t *testing.T) {
+	defer func(fn func(http.ResponseWriter, *http.Request) []session.Flash) { Flash = fn }(Flash)
+	calls := 0
+	Flash = func(w http.ResponseWriter, r *http.Request) []session.Flash {
+		calls++
+		return []session.Flash{{Level: "notice", Message: "Saved"}, {Level: "alert", Message: "Oops"}}
+	}
+
+	InitTemplates(fstest.MapFS{
+		"app/views/page.html.tmpl": {Data: []byte(`{{range flash "alert"}}{{.Message}}{{end}} {{len flash}}`)},
+	})
+	rec := httptest.NewRecorder()
+	if err := HTML(rec, httptest.NewRequest("GET", "/", nil), 200, "page.html.tmpl", nil); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.String() != "Oops 2" || calls != 1 {
+		t.Fatalf("got %q after %d reads", rec.Body.String(), calls)
+	}
+}
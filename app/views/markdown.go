@@ -0,0 +1,175 @@
+package views
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// Markdown renders the common subset of Markdown to HTML: paragraphs,
+// # headings, - and 1. lists, > quotes, fenced code blocks, horizontal rules,
+// `code`, **strong**, *emphasis* and [links](url). Raw HTML in the source is
+// escaped, and links with schemes other than http, https and mailto are
+// dropped, so the output is safe to show for user-written text.
+func Markdown(src string) template.HTML {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	renderBlocks(&b, lines)
+	return template.HTML(b.String())
+}
+
+var (
+	headingLine = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	ruleLine    = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+	bulletLine  = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedLine = regexp.MustCompile(`^\s{0,3}\d+[.)]\s+(.*)$`)
+)
+
+func renderBlocks(b *strings.Builder, lines []string) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + inline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code")
+			if lang != "" {
+				b.WriteString(` class="language-` + template.HTMLEscapeString(lang) + `"`)
+			}
+			b.WriteString(">" + template.HTMLEscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case headingLine.MatchString(trimmed):
+			flush()
+			m := headingLine.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			b.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+		case ruleLine.MatchString(trimmed):
+			flush()
+			b.WriteString("<hr>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quote)
+			b.WriteString("</blockquote>\n")
+		case bulletLine.MatchString(line) || orderedLine.MatchString(line):
+			flush()
+			item, tag := bulletLine, "ul"
+			if !bulletLine.MatchString(line) {
+				item, tag = orderedLine, "ol"
+			}
+			b.WriteString("<" + tag + ">\n")
+			for ; i < len(lines) && item.MatchString(lines[i]); i++ {
+				text := item.FindStringSubmatch(lines[i])[1]
+				// Indented lines continue the item.
+				for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "  ") && strings.TrimSpace(lines[i+1]) != "" &&
+					!item.MatchString(lines[i+1]) {
+					i++
+					text += "\n" + strings.TrimSpace(lines[i])
+				}
+				b.WriteString("<li>" + inline(text) + "</li>\n")
+			}
+			i--
+			b.WriteString("</" + tag + ">\n")
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+}
+
+// inline renders code spans, links, strong and emphasis in text, escaping
+// everything else.
+func inline(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				b.WriteString("<code>" + template.HTMLEscapeString(rest[1:1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+		case rest[0] == '[':
+			if label, href, n, ok := link(rest); ok {
+				if safe := safeHref(href); safe != "" {
+					b.WriteString(`<a href="` + template.HTMLEscapeString(safe) + `">` + inline(label) + "</a>")
+				} else {
+					b.WriteString(inline(label))
+				}
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if end := strings.Index(rest[2:], rest[:2]); end > 0 {
+				b.WriteString("<strong>" + inline(rest[2:2+end]) + "</strong>")
+				i += end + 4
+				continue
+			}
+		case rest[0] == '*' || (rest[0] == '_' && (i == 0 || !isWordByte(text[i-1]))):
+			if end := strings.IndexByte(rest[1:], rest[0]); end > 0 && rest[1] != ' ' {
+				b.WriteString("<em>" + inline(rest[1:1+end]) + "</em>")
+				i += end + 2
+				continue
+			}
+		case rest[0] == '\n':
+			b.WriteString("<br>\n")
+			i++
+			continue
+		}
+		b.WriteString(template.HTMLEscapeString(rest[:1]))
+		i++
+	}
+	return b.String()
+}
+
+// link parses [label](href) at the start of s and reports its length.
+func link(s string) (label, href string, n int, ok bool) {
+	mid := strings.Index(s, "](")
+	if mid < 0 {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(s[mid+2:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	return s[1:mid], strings.TrimSpace(s[mid+2 : mid+2+end]), mid + 3 + end, true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// safeHref returns href if it is relative or uses a harmless scheme, and ""
+// otherwise (e.g. javascript: URLs).
+func safeHref(href string) string {
+	lower := strings.ToLower(href)
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return href
+		}
+	}
+	if i := strings.IndexAny(lower, ":/?#"); i >= 0 && lower[i] == ':' {
+		return ""
+	}
+	return href
+}
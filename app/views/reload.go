@@ -0,0 +1,112 @@
+package views
+
+import (
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// reloader re-parses templates from disk when they change.
+type reloader struct {
+	fsys fs.FS
+	// mu serializes checks so a change is parsed once.
+	mu    sync.Mutex
+	stamp uint64
+	// err is the parse error of the files as they are now, if any.
+	err error
+}
+
+// reloading is set by InitReloadingTemplates.
+var reloading *reloader
+
+// ParseError is returned by Render while reloading templates that currently
+// don't parse.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string { return e.Err.Error() }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// InitReloadingTemplates is InitTemplates for development: templates are
+// read from fsys (usually os.DirFS(".")) and parsed again whenever a file
+// under app/views changes, so edits show up on the next request without a
+// rebuild. A template that doesn't parse is reported in the browser instead
+// of stopping the server.
+func InitReloadingTemplates(fsys fs.FS) {
+	mu.Lock()
+	templates = make(map[string]*page)
+	source = fsys
+	reloading = &reloader{fsys: fsys}
+	mu.Unlock()
+	if err := reload(); err != nil {
+		slog.Error("templates failed to parse", "error", err)
+	}
+}
+
+// reload parses the templates again if files under app/views changed since
+// the last call. It returns the current parse error, if any.
+func reload() error {
+	mu.RLock()
+	r := reloading
+	mu.RUnlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stamp, err := r.fingerprint()
+	if err != nil {
+		return err
+	}
+	if stamp == r.stamp {
+		return r.err
+	}
+	r.stamp = stamp
+	pages, err := load(r.fsys)
+	if err != nil {
+		r.err = &ParseError{Err: err}
+		return r.err
+	}
+	r.err = nil
+	mu.Lock()
+	templates = pages
+	mu.Unlock()
+	return nil
+}
+
+// fingerprint hashes the name, size and modification time of every file
+// under app/views.
+func (r *reloader) fingerprint() (uint64, error) {
+	h := fnv.New64a()
+	err := fs.WalkDir(r.fsys, viewsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		io.WriteString(h, p)
+		io.WriteString(h, strconv.FormatInt(info.Size(), 10))
+		io.WriteString(h, strconv.FormatInt(info.ModTime().UnixNano(), 10))
+		return nil
+	})
+	return h.Sum64(), err
+}
+
+// showParseError answers with the error page when err is a ParseError and
+// wr is a response.
+func showParseError(wr io.Writer, name string, err error) {
+	var pe *ParseError
+	w, ok := wr.(http.ResponseWriter)
+	if !ok || !errors.As(err, &pe) {
+		return
+	}
+	showError(w, name, nil, pe)
+}
@@ -0,0 +1,50 @@
+package views
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReloadingTemplates(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app", "views", "page.html.tmpl")
+	write := func(src string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`one`)
+	InitReloadingTemplates(os.DirFS(dir))
+	defer InitTemplates(layoutFiles)
+	if got := render(t, "page.html.tmpl", nil); got != "one" {
+		t.Fatalf("got %q", got)
+	}
+
+	write(`two, edited`)
+	if got := render(t, "page.html.tmpl", nil); got != "two, edited" {
+		t.Fatalf("edit not picked up, got %q", got)
+	}
+
+	write(`{{if}}`)
+	rec := httptest.NewRecorder()
+	var pe *ParseError
+	if err := Render(rec, "page.html.tmpl", nil); !errors.As(err, &pe) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if rec.Code != 500 || !strings.Contains(rec.Body.String(), "page.html.tmpl:1") {
+		t.Fatalf("expected the error page, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	write(`three, fixed`)
+	if got := render(t, "page.html.tmpl", nil); got != "three, fixed" {
+		t.Fatalf("fix not picked up, got %q", got)
+	}
+}
@@ -0,0 +1,207 @@
+package views
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"monolith/app/config"
+)
+
+// ErrorTemplate is the page HTML shows in production when a template fails.
+const ErrorTemplate = "500.html.tmpl"
+
+// buffers holds the buffers pages are rendered into before they are sent.
+var buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// maxPooledBuffer keeps the odd huge page from pinning its buffer forever.
+const maxPooledBuffer = 1 << 20
+
+func getBuffer() *bytes.Buffer {
+	buf := buffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		buffers.Put(buf)
+	}
+}
+
+// HTML renders a page for r and sends it with status. The page is rendered
+// into a buffer first, so a template that fails halfway sends an error page
+// instead of half a page: in development one showing the template, line and
+// data, in production ErrorTemplate. The error is returned after it has been
+// answered, for callers that want to log more. r may be nil when there is no
+// request, e.g. in tests; the request helpers then return nothing.
+func HTML(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}, opts ...RenderOption) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	opts = append([]RenderOption{WithRequest(r), withWriter(w)}, opts...)
+	if err := renderPage(buf, name, data, opts...); err != nil {
+		attrs := []interface{}{"template", name, "error", err}
+		if r != nil {
+			attrs = append(attrs, "path", r.URL.Path)
+		}
+		slog.Error("template failed", attrs...)
+		renderError(w, r, name, data, err)
+		return err
+	}
+	send(w, status, buf)
+	return nil
+}
+
+// withWriter lets the request helpers set headers, e.g. the session cookie
+// once flash messages have been read.
+func withWriter(w http.ResponseWriter) RenderOption {
+	return func(o *renderOptions) { o.writer = w }
+}
+
+func send(w http.ResponseWriter, status int, buf *bytes.Buffer) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// renderError answers a request whose page failed to render.
+func renderError(w http.ResponseWriter, r *http.Request, name string, data interface{}, err error) {
+	if config.IsDevelopment() {
+		showError(w, name, data, err)
+		return
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if name == ErrorTemplate {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if err := renderPage(buf, ErrorTemplate, nil, WithRequest(r)); err != nil {
+		slog.Error("error page failed", "template", ErrorTemplate, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	send(w, http.StatusInternalServerError, buf)
+}
+
+// templateError matches the position text/template puts in its errors:
+// "template: index.html.tmpl:12:5: executing ...".
+var templateError = regexp.MustCompile(`template: ([^:\s]+):(\d+)(?::\d+)?: `)
+
+// errorDetails describes a failed render for the development error page.
+type errorDetails struct {
+	Page    string
+	Error   string
+	File    string
+	Line    int
+	Source  []sourceLine
+	Data    string
+	HasData bool
+}
+
+type sourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// showError writes the development error page for err.
+func showError(w http.ResponseWriter, name string, data interface{}, err error) {
+	d := errorDetails{Page: name, Error: err.Error()}
+	if m := templateError.FindStringSubmatch(d.Error); m != nil {
+		d.File = sourceFile(m[1])
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Source = excerpt(d.File, d.Line)
+	}
+	if data != nil {
+		d.HasData = true
+		if b, err := json.MarshalIndent(data, "", "  "); err == nil {
+			d.Data = string(b)
+		} else {
+			d.Data = fmt.Sprintf("%#v", data)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	errorPage.Execute(w, d)
+}
+
+// sourceFile returns the file a template in an error message was parsed
+// from: layouts are named "layouts/NAME", partials after their path under
+// app/views, and pages after their file name.
+func sourceFile(name string) string {
+	if strings.HasPrefix(name, "layouts/") {
+		return path.Join(layoutsDir, strings.TrimPrefix(name, "layouts/")+".html.tmpl")
+	}
+	if strings.Contains(name, "/") || strings.HasPrefix(name, "_") {
+		return path.Join(viewsDir, name)
+	}
+	mu.RLock()
+	fsys := source
+	mu.RUnlock()
+	file := path.Join(viewsDir, name)
+	if fsys == nil {
+		return file
+	}
+	fs.WalkDir(fsys, viewsDir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && d.Name() == name {
+			file = p
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return file
+}
+
+// excerpt returns the lines of file around line.
+func excerpt(file string, line int) []sourceLine {
+	mu.RLock()
+	fsys := source
+	mu.RUnlock()
+	if fsys == nil || line < 1 {
+		return nil
+	}
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(string(b), "\n")
+	var out []sourceLine
+	for n := max(line-5, 1); n <= min(line+5, len(lines)); n++ {
+		out = append(out, sourceLine{Number: n, Text: lines[n-1], Current: n == line})
+	}
+	return out
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>Template error</title></head>
+<body style="font-family: system-ui, sans-serif; margin: 2rem">
+<h1>Template error</h1>
+<p>Rendering <code>{{.Page}}</code> failed.{{if .File}} The error is in <code>{{.File}}</code> on line {{.Line}}.{{end}}</p>
+<pre style="background: #fdecea; padding: 1rem; white-space: pre-wrap">{{.Error}}</pre>
+{{- if .Source}}
+<h2>{{.File}}</h2>
+<pre style="background: #f6f8fa; padding: 1rem">
+{{- range .Source}}
+<span{{if .Current}} style="background: #ffe08a"{{end}}>{{printf "%4d" .Number}}  {{.Text}}</span>
+{{- end}}
+</pre>
+{{- end}}
+{{- if .HasData}}
+<h2>Data</h2>
+<pre style="background: #f6f8fa; padding: 1rem; white-space: pre-wrap">{{.Data}}</pre>
+{{- end}}
+</body>
+</html>`))
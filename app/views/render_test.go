@@ -0,0 +1,79 @@
+package views
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"monolith/app/config"
+)
+
+var errorFiles = fstest.MapFS{
+	"app/views/layouts/application.html.tmpl": {Data: []byte(`<app>{{block "body" .}}{{end}}</app>`)},
+	"app/views/ok.html.tmpl":                  {Data: []byte(`{{define "body"}}hi {{.}}{{end}}`)},
+	"app/views/pages/broken.html.tmpl": {Data: []byte("{{define \"body\"}}start\n" +
+		"{{.Name.Missing}}\n{{end}}")},
+	"app/views/500.html.tmpl": {Data: []byte(`{{define "body"}}sorry{{end}}`)},
+}
+
+func TestHTML(t *testing.T) {
+	InitTemplates(errorFiles)
+	defer func(env string) { config.APP_ENV = env }(config.APP_ENV)
+
+	rec := httptest.NewRecorder()
+	if err := HTML(rec, httptest.NewRequest("GET", "/", nil), 201, "ok.html.tmpl", "there"); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != 201 || rec.Body.String() != "<app>hi there</app>" {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("content type %q", ct)
+	}
+
+	data := map[string]interface{}{"Name": "widget"}
+	config.APP_ENV = "production"
+	rec = httptest.NewRecorder()
+	if err := HTML(rec, httptest.NewRequest("GET", "/", nil), 200, "broken.html.tmpl", data); err == nil {
+		t.Fatal("expected an error")
+	}
+	if rec.Code != 500 || rec.Body.String() != "<app>sorry</app>" {
+		t.Fatalf("expected the 500 page, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	config.APP_ENV = "development"
+	rec = httptest.NewRecorder()
+	HTML(rec, httptest.NewRequest("GET", "/", nil), 200, "broken.html.tmpl", data)
+	body := rec.Body.String()
+	if rec.Code != 500 || strings.Contains(body, "<app>") {
+		t.Fatalf("expected the error page without the partial render, got %d %q", rec.Code, body)
+	}
+	for _, want := range []string{"app/views/pages/broken.html.tmpl", "line 2", "{{.Name.Missing}}", "&#34;widget&#34;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("error page is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestHTMLWithoutRequest(t *testing.T) {
+	InitTemplates(errorFiles)
+	defer func(env string) { config.APP_ENV = env }(config.APP_ENV)
+
+	rec := httptest.NewRecorder()
+	if err := HTML(rec, nil, 200, "ok.html.tmpl", "there"); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.String() != "<app>hi there</app>" {
+		t.Fatalf("got %q", rec.Body.String())
+	}
+
+	config.APP_ENV = "production"
+	rec = httptest.NewRecorder()
+	if err := HTML(rec, nil, 200, "broken.html.tmpl", map[string]interface{}{"Name": "widget"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if rec.Code != 500 || rec.Body.String() != "<app>sorry</app>" {
+		t.Fatalf("expected the 500 page, got %d %q", rec.Code, rec.Body.String())
+	}
+}
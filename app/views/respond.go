@@ -0,0 +1,128 @@
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Format is the kind of response a request asks for.
+type Format int
+
+const (
+	// FormatHTML is a full page inside its layout.
+	FormatHTML Format = iota
+	// FormatJSON is the data encoded as JSON.
+	FormatJSON
+	// FormatFragment is the page's FragmentBlock without the layout, for
+	// htmx and Turbo requests that swap part of a page.
+	FormatFragment
+)
+
+// FragmentBlock is the block Respond renders for fragment requests.
+var FragmentBlock = "body"
+
+// Suffixes maps a path suffix to the format it asks for; see WithFormat.
+var Suffixes = map[string]Format{
+	".json": FormatJSON,
+}
+
+type formatKey struct{}
+
+// WithFormat returns r asking for f whatever its headers say. The format
+// middleware uses it for URLs ending in one of Suffixes.
+func WithFormat(r *http.Request, f Format) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), formatKey{}, f))
+}
+
+// RequestFormat picks the format to answer r with: the one set with
+// WithFormat, a fragment for htmx (HX-Request, unless boosted) and Turbo
+// frame requests, JSON when Accept prefers it to HTML, and HTML otherwise.
+func RequestFormat(r *http.Request) Format {
+	if f, ok := r.Context().Value(formatKey{}).(Format); ok {
+		return f
+	}
+	if r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true" {
+		return FormatFragment
+	}
+	if r.Header.Get("Turbo-Frame") != "" {
+		return FormatFragment
+	}
+	if accepts(r, "application/json") > accepts(r, "text/html") {
+		return FormatJSON
+	}
+	return FormatHTML
+}
+
+// accepts returns the quality r's Accept header gives mediaType: 1 without
+// a header, 0 when it isn't accepted.
+func accepts(r *http.Request, mediaType string) float64 {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return 1
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	best, specificity := 0.0, -1
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(params[0]))
+		var s int
+		switch rng {
+		case mediaType:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s < specificity {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				q, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		best, specificity = q, s
+	}
+	return best
+}
+
+// Respond answers r in the format it asks for (see RequestFormat): the page
+// with HTML, data with JSON, or the page's FragmentBlock alone. One action
+// serves browsers, API clients and partial page updates:
+//
+//	views.Respond(w, r, http.StatusOK, "widgets_show.html.tmpl", widget)
+func Respond(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}, opts ...RenderOption) error {
+	w.Header().Add("Vary", "Accept, HX-Request, Turbo-Frame")
+	switch RequestFormat(r) {
+	case FormatJSON:
+		return JSON(w, status, data)
+	case FormatFragment:
+		return HTML(w, r, status, name, data, append(opts, Block(FragmentBlock))...)
+	}
+	return HTML(w, r, status, name, data, opts...)
+}
+
+// JSON sends data encoded as JSON with status. If data can't be encoded the
+// response is a 500 with a JSON error instead.
+func JSON(w http.ResponseWriter, status int, data interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
+		slog.Error("json encoding failed", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Internal Server Error"}` + "\n"))
+		return err
+	}
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+	return nil
+}
@@ -0,0 +1,60 @@
+package views
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestFormat(t *testing.T) {
+	tests := []struct {
+		headers map[string]string
+		want    Format
+	}{
+		{nil, FormatHTML},
+		{map[string]string{"Accept": "text/html,application/xhtml+xml,*/*;q=0.8"}, FormatHTML},
+		{map[string]string{"Accept": "application/json"}, FormatJSON},
+		{map[string]string{"Accept": "application/json, text/html;q=0.5"}, FormatJSON},
+		{map[string]string{"Accept": "*/*"}, FormatHTML},
+		{map[string]string{"HX-Request": "true"}, FormatFragment},
+		{map[string]string{"HX-Request": "true", "HX-Boosted": "true"}, FormatHTML},
+		{map[string]string{"Turbo-Frame": "widgets"}, FormatFragment},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := RequestFormat(r); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.headers, got, tt.want)
+		}
+	}
+	r := WithFormat(httptest.NewRequest("GET", "/", nil), FormatJSON)
+	if got := RequestFormat(r); got != FormatJSON {
+		t.Errorf("WithFormat: got %v", got)
+	}
+}
+
+func TestRespond(t *testing.T) {
+	InitTemplates(layoutFiles)
+	tests := []struct {
+		header, value string
+		body, ctype   string
+	}{
+		{"", "", "<app>home 1</app>", "text/html; charset=utf-8"},
+		{"Accept", "application/json", "1\n", "application/json; charset=utf-8"},
+		{"HX-Request", "true", "home 1", "text/html; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		if err := Respond(rec, r, 200, "home.html.tmpl", 1); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Body.String() != tt.body || rec.Header().Get("Content-Type") != tt.ctype {
+			t.Errorf("%s: got %q %q", tt.header, rec.Body.String(), rec.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -2,42 +2,491 @@
 package views
 
 import (
-	"embed"
+	"bytes"
 	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+
+	"monolith/app/session"
+)
+
+// Layouts live in app/views/layouts/, one per file, and are named after the
+// file: app/views/layouts/admin.html.tmpl is the "admin" layout. A page uses
+// the layout named after its directory if there is one (app/views/admin/...
+// uses "admin"), and DefaultLayout otherwise.
+//
+// A layout can extend another one by starting with a comment naming it:
+//
+//	{{/* extends "application" */}}
+//	{{define "body"}}<nav>...</nav>{{block "content" .}}{{end}}{{end}}
+//
+// The inner layout fills blocks of the outer one and declares new blocks for
+// its pages to fill.
+//
+// Partials are snippets shared by pages: files whose name starts with "_" and
+// every file under app/views/shared/. They are parsed into every page and
+// named after their path without the underscore and extension, so
+// app/views/widgets/_form.html.tmpl is "widgets/form" and
+// app/views/shared/pagination.html.tmpl is "shared/pagination". Include one
+// with the partial helper, passing its data or key/value locals:
+//
+//	{{partial "widgets/form" .Widget}}
+//	{{partial "shared/pagination" "page" .Page "total" .Total}}
+const (
+	viewsDir   = "app/views"
+	layoutsDir = "app/views/layouts"
+	sharedDir  = "app/views/shared"
+	// DefaultLayout is the layout of pages whose directory has none.
+	DefaultLayout = "application"
 )
 
 // Template cache. InitTemplates() fills this with all HTML templates from embedded filesystem
-// cached templates keyed by filename
-var templates map[string]*template.Template
+// cached templates keyed by filename. mu guards it because reloading
+// (see InitReloadingTemplates) replaces it while requests are served.
+var (
+	mu        sync.RWMutex
+	templates map[string]*page
+	// source holds the files the templates were parsed from, which error
+	// pages quote.
+	source fs.FS
+)
+
+// page is a template parsed once per layout it can be rendered with.
+type page struct {
+	// layout is the page's layout by convention, "" if it has none.
+	layout string
+	// sets maps a layout name to the page parsed with that layout; "" holds
+	// the page on its own.
+	sets map[string]*set
+}
+
+// set is a page parsed with one layout. Its template is never executed, so
+// it can be cloned: each render takes a clone from the pool, whose request
+// helpers read the request being rendered. Clones are escaped by their first
+// render and reused, so only the first render of a clone pays for escaping.
+type set struct {
+	page string
+	// t holds the page, its partials and its layouts; entry names the one to
+	// execute: the outermost layout, or the page.
+	t        *template.Template
+	entry    string
+	partials map[string]partial
+	pool     sync.Pool
+}
+
+// instance is a clone of a set's template and the render it is used for.
+type instance struct {
+	t *template.Template
+	// r is the request being rendered, if any, and w its response when
+	// rendered by HTML.
+	r *http.Request
+	w http.ResponseWriter
+	// flashes are the messages read by the first flash call of the render.
+	flashes   []session.Flash
+	flashRead bool
+}
+
+// execute renders the set's page, or o.block of it, with data for the
+// request in o, which may be nil.
+func (s *set) execute(wr io.Writer, o *renderOptions, data interface{}) error {
+	inst, err := s.instance()
+	if err != nil {
+		return err
+	}
+	defer s.pool.Put(inst)
+	inst.r, inst.w = o.request, o.writer
+	defer func() { inst.r, inst.w, inst.flashes, inst.flashRead = nil, nil, nil, false }()
+	t := inst.t
+	name := s.entry
+	if o.block != "" {
+		name = o.block
+	}
+	if t.Lookup(name) == nil {
+		return fmt.Errorf("block %s not found in template %s", o.block, s.page)
+	}
+	return t.ExecuteTemplate(wr, name, data)
+}
 
-// parse all templates and store them in the template cache
-func InitTemplates(templateFiles embed.FS) {
-	templates = make(map[string]*template.Template)
-	fs.WalkDir(templateFiles, "app/views", func(path string, d fs.DirEntry, err error) error {
+// instance takes a clone from the pool, or makes one whose helpers are bound
+// to it.
+func (s *set) instance() (*instance, error) {
+	if inst, ok := s.pool.Get().(*instance); ok {
+		return inst, nil
+	}
+	t, err := s.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	inst := &instance{t: t}
+	t.Funcs(inst.funcs(s.partials))
+	return inst, nil
+}
+
+// layout is the source of a layout file and the layout it extends, if any.
+type layout struct {
+	src    string
+	parent string
+}
+
+var extendsDirective = regexp.MustCompile(`^\s*\{\{-?\s*/\*\s*extends\s+"([^"]+)"\s*\*/\s*-?\}\}`)
+
+// parse all templates and store them in the template cache. templateFiles is
+// normally the embed.FS from main.go; any fs.FS rooted like the project works.
+// It panics if a template doesn't parse.
+func InitTemplates(templateFiles fs.FS) {
+	pages, err := load(templateFiles)
+	if err != nil {
+		panic(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	templates = pages
+	source = templateFiles
+	reloading = nil
+}
+
+// load parses every page. Parsing panics on the first broken template, like
+// template.Must; load turns that into an error.
+func load(templateFiles fs.FS) (pages map[string]*page, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	layouts := loadLayouts(templateFiles)
+	partials := loadPartials(templateFiles)
+	pages = make(map[string]*page)
+	err = fs.WalkDir(templateFiles, viewsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == layoutsDir || p == sharedDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".html.tmpl") || strings.HasPrefix(d.Name(), "_") {
+			return nil
+		}
+		src := readFile(templateFiles, p)
+		pg := &page{
+			layout: layoutFor(p, layouts),
+			sets:   make(map[string]*set),
+		}
+		for _, name := range append([]string{""}, layoutNames(layouts)...) {
+			pg.sets[name] = parsePage(d.Name(), src, name, layouts, partials)
+		}
+		pages[d.Name()] = pg
+		return nil
+	})
+	return pages, err
+}
+
+// lookup returns the named page, reloading templates first if they changed.
+func lookup(name string) (*page, error) {
+	if err := reload(); err != nil {
+		return nil, err
+	}
+	mu.RLock()
+	p, ok := templates[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+	return p, nil
+}
+
+func readFile(fsys fs.FS, name string) string {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		panic(fmt.Sprintf("views: %v", err))
+	}
+	return string(b)
+}
+
+// loadLayouts reads every layout in app/views/layouts and checks what they
+// extend.
+func loadLayouts(fsys fs.FS) map[string]layout {
+	layouts := make(map[string]layout)
+	entries, err := fs.ReadDir(fsys, layoutsDir)
+	if err != nil {
+		// No layouts directory: every page renders on its own.
+		return layouts
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".html.tmpl") {
+			continue
+		}
+		src := readFile(fsys, path.Join(layoutsDir, e.Name()))
+		l := layout{src: src}
+		if m := extendsDirective.FindStringSubmatch(src); m != nil {
+			l.parent = m[1]
+		}
+		layouts[strings.TrimSuffix(e.Name(), ".html.tmpl")] = l
+	}
+	for name := range layouts {
+		layoutChain(name, layouts)
+	}
+	return layouts
+}
+
+// partial is a partial's file, relative to app/views, which names its
+// template in every set, and its source.
+type partial struct {
+	file string
+	src  string
+}
+
+// loadPartials reads every partial, keyed by partial name.
+func loadPartials(fsys fs.FS) map[string]partial {
+	partials := make(map[string]partial)
+	fs.WalkDir(fsys, viewsDir, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if d.IsDir() || !strings.HasSuffix(d.Name(), ".html.tmpl") {
 			return nil
 		}
-		if d.Name() == "base.html.tmpl" {
+		if !strings.HasPrefix(d.Name(), "_") && !strings.HasPrefix(p, sharedDir+"/") {
 			return nil
 		}
-		t := template.Must(template.ParseFS(templateFiles, "app/views/base.html.tmpl", path))
-		templates[d.Name()] = t
+		file := strings.TrimPrefix(p, viewsDir+"/")
+		dir, name := path.Split(file)
+		name = strings.TrimPrefix(strings.TrimSuffix(name, ".html.tmpl"), "_")
+		partials[dir+name] = partial{file: file, src: readFile(fsys, p)}
 		return nil
 	})
+	return partials
+}
+
+// partialFile returns the file loadPartials reads the named partial from:
+// shared partials keep their plain name, the others start with "_".
+func partialFile(name string) string {
+	if strings.HasPrefix(name, path.Base(sharedDir)+"/") {
+		return viewsDir + "/" + name + ".html.tmpl"
+	}
+	dir, file := path.Split(name)
+	return viewsDir + "/" + dir + "_" + file + ".html.tmpl"
+}
+
+// parsePage parses a page after every partial and the layouts it renders
+// in, so the blocks it defines replace theirs. layoutName is "" to parse it
+// on its own.
+func parsePage(name, src, layoutName string, layouts map[string]layout, partials map[string]partial) *set {
+	// The request helpers only need to exist to parse; every render replaces
+	// them with its own.
+	t := template.New(name).Funcs((&instance{}).funcs(partials))
+	for _, p := range partials {
+		template.Must(t.New(p.file).Parse(p.src))
+	}
+	var chain []string
+	if layoutName != "" {
+		chain = layoutChain(layoutName, layouts)
+	}
+	for _, l := range chain {
+		template.Must(t.New("layouts/" + l).Parse(layouts[l].src))
+	}
+	template.Must(t.Parse(src))
+	s := &set{page: name, t: t, entry: name, partials: partials}
+	if len(chain) > 0 {
+		s.entry = "layouts/" + chain[0]
+	}
+	return s
+}
+
+// funcs returns the functions available to the render's templates: the
+// standard ones, those registered with Funcs, and the helpers that depend on
+// the render in progress.
+func (inst *instance) funcs(partials map[string]partial) template.FuncMap {
+	m := template.FuncMap{}
+	for name, fn := range builtinFuncs {
+		m[name] = fn
+	}
+	for name, fn := range appFuncs {
+		m[name] = fn
+	}
+	m["request"] = func() *http.Request { return inst.r }
+	m["currentUser"] = func() interface{} { return CurrentUser(inst.r) }
+	m["flash"] = inst.flash
+	m["partial"] = func(name string, args ...interface{}) (template.HTML, error) {
+		p, ok := partials[name]
+		if !ok {
+			return "", fmt.Errorf("partial %q not found: expected %s", name, partialFile(name))
+		}
+		return renderPartial(inst.t.Lookup(p.file), name, args)
+	}
+	return m
+}
+
+// flash returns the render's flash messages, only those of levels if any
+// are given. The messages are read once per render, so a layout and its
+// page can both show some.
+func (inst *instance) flash(levels ...string) []session.Flash {
+	if !inst.flashRead {
+		inst.flashes, inst.flashRead = Flash(inst.w, inst.r), true
+	}
+	if len(levels) == 0 {
+		return inst.flashes
+	}
+	var out []session.Flash
+	for _, f := range inst.flashes {
+		for _, l := range levels {
+			if f.Level == l {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// renderPartial executes a partial. args is either the partial's data or
+// key/value pairs collected into a map of locals.
+func renderPartial(t *template.Template, name string, args []interface{}) (template.HTML, error) {
+	var data interface{}
+	switch {
+	case len(args) == 1:
+		data = args[0]
+	case len(args) > 1:
+		locals, err := dict(args...)
+		if err != nil {
+			return "", fmt.Errorf("partial %q: locals: %w", name, err)
+		}
+		data = locals
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	// The partial's output was escaped when it was executed.
+	return template.HTML(b.String()), nil
+}
+
+// layoutChain returns the layouts a page rendered with name is wrapped in,
+// outermost first.
+func layoutChain(name string, layouts map[string]layout) []string {
+	var chain []string
+	seen := make(map[string]bool)
+	for l := name; l != ""; l = layouts[l].parent {
+		if _, ok := layouts[l]; !ok {
+			panic(fmt.Sprintf("views: layout %s extends missing layout %s", chain[0], l))
+		}
+		if seen[l] {
+			panic(fmt.Sprintf("views: layout %s extends itself", name))
+		}
+		seen[l] = true
+		chain = append([]string{l}, chain...)
+	}
+	return chain
+}
+
+// layoutFor picks a page's layout by convention: the one named after the
+// closest directory that has one, then DefaultLayout.
+func layoutFor(file string, layouts map[string]layout) string {
+	for dir := path.Dir(file); dir != viewsDir && dir != "."; dir = path.Dir(dir) {
+		if _, ok := layouts[path.Base(dir)]; ok {
+			return path.Base(dir)
+		}
+	}
+	if _, ok := layouts[DefaultLayout]; ok {
+		return DefaultLayout
+	}
+	return ""
+}
+
+func layoutNames(layouts map[string]layout) []string {
+	names := make([]string, 0, len(layouts))
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderOption changes how Render renders a template.
+type RenderOption func(*renderOptions)
+
+type renderOptions struct {
+	layout  string
+	block   string
+	request *http.Request
+	// writer is the response HTML renders for.
+	writer http.ResponseWriter
+}
+
+// Layout renders the page inside the named layout from app/views/layouts
+// instead of its default one.
+func Layout(name string) RenderOption {
+	return func(o *renderOptions) { o.layout = name }
+}
+
+// NoLayout renders the page without any layout: only its content outside
+// {{define}} blocks is written, which suits fragments.
+func NoLayout() RenderOption {
+	return Layout("")
+}
+
+// Block renders only the named block (a {{define "name"}} section) of the
+// page, without the layout.
+func Block(name string) RenderOption {
+	return func(o *renderOptions) { o.block = name }
+}
+
+// WithRequest gives the request helpers (request, currentUser, flash) the
+// request being answered. Without it they return nothing.
+func WithRequest(r *http.Request) RenderOption {
+	return func(o *renderOptions) { o.request = r }
 }
 
 // Render executes a named template with the provided data and writes the output to the given writer.
-func Render(wr io.Writer, name string, data interface{}) error {
-	t, ok := templates[name]
+// The page is wrapped in its layout unless opts pick another one or none.
+// Nothing of the page is written if the template fails. The one exception is
+// development, where templates are reloaded from disk: if they no longer
+// parse and wr is an http.ResponseWriter, the error page is written to it.
+// Controllers answering a request should use HTML, which also sets the
+// status and handles the error.
+func Render(wr io.Writer, name string, data interface{}, opts ...RenderOption) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := renderPage(buf, name, data, opts...); err != nil {
+		showParseError(wr, name, err)
+		return err
+	}
+	_, err := buf.WriteTo(wr)
+	return err
+}
+
+// renderPage executes a page into buf.
+func renderPage(buf *bytes.Buffer, name string, data interface{}, opts ...RenderOption) error {
+	p, err := lookup(name)
+	if err != nil {
+		return err
+	}
+	o := renderOptions{layout: p.layout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s, ok := p.sets[o.layout]
 	if !ok {
-		return fmt.Errorf("template %s not found", name)
+		return fmt.Errorf("layout %s not found", o.layout)
 	}
-	return t.ExecuteTemplate(wr, "base.html.tmpl", data)
+	return s.execute(buf, &o, data)
+}
+
+// RenderBlock executes a single named block (a {{define "name"}} section) of a
+// template without the layout, e.g. to render a fragment for a live update.
+func RenderBlock(wr io.Writer, name, block string, data interface{}) error {
+	return Render(wr, name, data, Block(block))
 }
@@ -0,0 +1,144 @@
+package views
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+var layoutFiles = fstest.MapFS{
+	"app/views/layouts/application.html.tmpl": {Data: []byte(`<app>{{block "body" .}}{{end}}</app>`)},
+	"app/views/layouts/admin.html.tmpl": {Data: []byte(`{{/* extends "application" */}}` +
+		`{{define "body"}}<admin>{{block "content" .}}{{end}}</admin>{{end}}`)},
+	"app/views/layouts/mailer.html.tmpl":  {Data: []byte(`<mail>{{block "body" .}}{{end}}</mail>`)},
+	"app/views/home.html.tmpl":            {Data: []byte(`{{define "body"}}home {{.}}{{end}}`)},
+	"app/views/admin/dashboard.html.tmpl": {Data: []byte(`{{define "content"}}dashboard{{end}}`)},
+	"app/views/widgets/row.html.tmpl":     {Data: []byte(`<tr>{{.}}</tr>{{define "body"}}table{{end}}`)},
+}
+
+func render(t *testing.T, name string, data interface{}, opts ...RenderOption) string {
+	t.Helper()
+	var b strings.Builder
+	if err := Render(&b, name, data, opts...); err != nil {
+		t.Fatalf("render %s: %v", name, err)
+	}
+	return b.String()
+}
+
+func TestLayouts(t *testing.T) {
+	InitTemplates(layoutFiles)
+	tests := []struct {
+		name string
+		opts []RenderOption
+		want string
+	}{
+		{"home.html.tmpl", nil, "<app>home 1</app>"},
+		{"dashboard.html.tmpl", nil, "<app><admin>dashboard</admin></app>"},
+		{"home.html.tmpl", []RenderOption{Layout("mailer")}, "<mail>home 1</mail>"},
+		{"row.html.tmpl", nil, "<app>table</app>"},
+		{"row.html.tmpl", []RenderOption{NoLayout()}, "<tr>1</tr>"},
+	}
+	for _, tt := range tests {
+		if got := render(t, tt.name, 1, tt.opts...); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	var b strings.Builder
+	if err := Render(&b, "home.html.tmpl", nil, Layout("missing")); err == nil {
+		t.Errorf("expected an error for a missing layout")
+	}
+}
+
+func TestLayoutCycle(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic for a layout cycle")
+		}
+	}()
+	InitTemplates(fstest.MapFS{
+		"app/views/layouts/a.html.tmpl": {Data: []byte(`{{/* extends "b" */}}`)},
+		"app/views/layouts/b.html.tmpl": {Data: []byte(`{{/* extends "a" */}}`)},
+	})
+}
+
+func TestPartials(t *testing.T) {
+	InitTemplates(fstest.MapFS{
+		"app/views/layouts/application.html.tmpl": {Data: []byte(`{{partial "shared/nav"}}{{block "body" .}}{{end}}`)},
+		"app/views/shared/nav.html.tmpl":          {Data: []byte(`<nav></nav>`)},
+		"app/views/widgets/_row.html.tmpl":        {Data: []byte(`<tr>{{.name}}{{if .admin}}!{{end}}</tr>`)},
+		"app/views/widgets/_item.html.tmpl":       {Data: []byte(`<li>{{.}}</li>`)},
+		"app/views/_footer.html.tmpl":             {Data: []byte(`<footer></footer>`)},
+		"app/views/widgets/index.html.tmpl": {Data: []byte(`{{define "body"}}` +
+			`{{partial "widgets/row" "name" "<b>" "admin" true}}{{partial "widgets/item" .}}{{partial "footer"}}{{end}}`)},
+		"app/views/broken.html.tmpl":        {Data: []byte(`{{define "body"}}{{partial "widgets/missing"}}{{end}}`)},
+		"app/views/broken_shared.html.tmpl": {Data: []byte(`{{define "body"}}{{partial "shared/missing"}}{{end}}`)},
+	})
+	if _, ok := templates["_row.html.tmpl"]; ok {
+		t.Fatalf("partials should not be pages")
+	}
+	want := `<nav></nav><tr>&lt;b&gt;!</tr><li>1</li><footer></footer>`
+	if got := render(t, "index.html.tmpl", 1); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	var b strings.Builder
+	err := Render(&b, "broken.html.tmpl", nil)
+	if err == nil || !strings.Contains(err.Error(), `partial "widgets/missing" not found`) ||
+		!strings.Contains(err.Error(), "app/views/widgets/_missing.html.tmpl") {
+		t.Fatalf("expected a missing partial error, got %v", err)
+	}
+	err = Render(&b, "broken_shared.html.tmpl", nil)
+	if err == nil || !strings.Contains(err.Error(), "expected app/views/shared/missing.html.tmpl") {
+		t.Fatalf("expected the shared partial's file in the error, got %v", err)
+	}
+}
+
+func TestConcurrentRenders(t *testing.T) {
+	InitTemplates(fstest.MapFS{
+		"app/views/layouts/application.html.tmpl": {Data: []byte(`<app>{{request.URL.Path}}{{block "body" .}}{{end}}</app>`)},
+		"app/views/page.html.tmpl":                {Data: []byte(`{{define "body"}} {{request.URL.Path}}{{end}}`)},
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/%d", i)
+			var b strings.Builder
+			if err := Render(&b, "page.html.tmpl", nil, WithRequest(httptest.NewRequest("GET", path, nil))); err != nil {
+				t.Error(err)
+				return
+			}
+			if want := "<app>" + path + " " + path + "</app>"; b.String() != want {
+				t.Errorf("got %q, want %q", b.String(), want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkRender(b *testing.B) {
+	InitTemplates(fstest.MapFS{
+		"app/views/layouts/application.html.tmpl": {Data: []byte(
+			`<html><head><title>{{.Title}}</title></head><body>{{partial "shared/nav"}}{{block "body" .}}{{end}}</body></html>`)},
+		"app/views/shared/nav.html.tmpl": {Data: []byte(`<nav><a href="/">{{request.URL.Path}}</a></nav>`)},
+		"app/views/index.html.tmpl": {Data: []byte(
+			`{{define "body"}}<ul>{{range .Items}}<li><a href="/items/{{.}}">{{.}}</a></li>{{end}}</ul>{{end}}`)},
+	})
+	data := map[string]interface{}{"Title": "Items", "Items": []string{"a", "b", "c", "d"}}
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var buf strings.Builder
+		for pb.Next() {
+			buf.Reset()
+			if err := Render(&buf, "index.html.tmpl", data, WithRequest(r)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -361,7 +361,8 @@ func createModelFile(modelName string, fields []string) error {
 	buf.WriteString("}\n\n")
 
 	buf.WriteString(fmt.Sprintf("// AfterSave is triggered by GORM after a %s has been saved.\n", camelName))
-	buf.WriteString("// This can be used for post-save actions or additional validation.\n")
+	buf.WriteString("// This can be used for post-save actions or additional validation, e.g.\n")
+	buf.WriteString("// BroadcastStream to push the change to pages that display it.\n")
 	buf.WriteString(fmt.Sprintf("func (m *%s) AfterSave(tx *gorm.DB) error {\n", camelName))
 	buf.WriteString("\treturn nil\n")
 	buf.WriteString("}\n\n")
@@ -470,6 +471,7 @@ func createControllerFile(name string, actions []string) error {
 	needDB := false
 	needTemplates := false
 	needStrconv := false
+	needSession := false
 	for _, a := range actions {
 		switch a {
 		case "index", "show", "create", "edit", "update", "destroy":
@@ -482,8 +484,16 @@ func createControllerFile(name string, actions []string) error {
 		switch a {
 		case "index", "show", "new", "edit":
 			needTemplates = true
+		case "create", "update", "destroy":
+			// JSON clients get the record instead of a redirect, browsers
+			// a flash message
+			needTemplates = needTemplates || hasModel
+			needSession = needSession || hasModel
 		}
 	}
+	// label names a record in flash messages, e.g. "Blog post"
+	label := strings.ReplaceAll(toSnakeCase(modelName), "_", " ")
+	label = strings.ToUpper(label[:1]) + label[1:]
 	if needDB && !hasModel {
 		// without a corresponding model file we cannot use the db package
 		needDB = false
@@ -502,6 +512,9 @@ func createControllerFile(name string, actions []string) error {
 	if needDB {
 		imports = append(imports, "\"monolith/db\"", "\"monolith/app/models\"")
 	}
+	if needSession {
+		imports = append(imports, "\"monolith/app/session\"")
+	}
 	if len(imports) > 1 {
 		buf.WriteString("import (\n")
 		for _, imp := range imports {
@@ -521,9 +534,9 @@ func createControllerFile(name string, actions []string) error {
 			buf.WriteString(fmt.Sprintf("func (c *%s) Index(w http.ResponseWriter, r *http.Request) {\n", ctrlName))
 			if hasModel {
 				buf.WriteString(fmt.Sprintf("\trecords, _ := models.GetAll%s(db.GetDB())\n", pluralModelName))
-				buf.WriteString(fmt.Sprintf("\tviews.Render(w, \"%s_index.html.tmpl\", records)\n", toSnakeCase(name)))
+				buf.WriteString(fmt.Sprintf("\tviews.Respond(w, r, http.StatusOK, \"%s_index.html.tmpl\", records)\n", toSnakeCase(name)))
 			} else {
-				buf.WriteString(fmt.Sprintf("\tviews.Render(w, \"%s_index.html.tmpl\", nil)\n", toSnakeCase(name)))
+				buf.WriteString(fmt.Sprintf("\tviews.Respond(w, r, http.StatusOK, \"%s_index.html.tmpl\", nil)\n", toSnakeCase(name)))
 			}
 			buf.WriteString("}\n\n")
 		case "show":
@@ -532,21 +545,28 @@ func createControllerFile(name string, actions []string) error {
 				buf.WriteString("\tidStr := r.PathValue(\"id\")\n")
 				buf.WriteString("\tid, _ := strconv.Atoi(idStr)\n")
 				buf.WriteString(fmt.Sprintf("\trecord, _ := models.Get%sByID(db.GetDB(), uint(id))\n", modelName))
-				buf.WriteString(fmt.Sprintf("\tviews.Render(w, \"%s_show.html.tmpl\", record)\n", toSnakeCase(name)))
+				buf.WriteString(fmt.Sprintf("\tviews.Respond(w, r, http.StatusOK, \"%s_show.html.tmpl\", record)\n", toSnakeCase(name)))
 			} else {
-				buf.WriteString(fmt.Sprintf("\tviews.Render(w, \"%s_show.html.tmpl\", nil)\n", toSnakeCase(name)))
+				buf.WriteString(fmt.Sprintf("\tviews.Respond(w, r, http.StatusOK, \"%s_show.html.tmpl\", nil)\n", toSnakeCase(name)))
 			}
 			buf.WriteString("}\n\n")
 		case "new":
 			buf.WriteString(fmt.Sprintf("func (c *%s) New(w http.ResponseWriter, r *http.Request) {\n", ctrlName))
-			buf.WriteString(fmt.Sprintf("\tviews.Render(w, \"%s_new.html.tmpl\", nil)\n", toSnakeCase(name)))
+			buf.WriteString(fmt.Sprintf("\tviews.Respond(w, r, http.StatusOK, \"%s_new.html.tmpl\", nil)\n", toSnakeCase(name)))
 			buf.WriteString("}\n\n")
 		case "create":
 			buf.WriteString(fmt.Sprintf("func (c *%s) Create(w http.ResponseWriter, r *http.Request) {\n", ctrlName))
 			if hasModel {
 				buf.WriteString(fmt.Sprintf("\tvar record models.%s\n", modelName))
 				buf.WriteString("\t// TODO: parse form values into &record\n")
-				buf.WriteString(fmt.Sprintf("\t_ = models.Create%s(db.GetDB(), &record)\n", modelName))
+				buf.WriteString(fmt.Sprintf("\tif err := models.Create%s(db.GetDB(), &record); err != nil {\n", modelName))
+				writeSaveError(&buf, label+" could not be created", fmt.Sprintf("\"/%s/new\"", toSnakeCase(name)))
+				buf.WriteString("\t}\n")
+				buf.WriteString("\tif views.RequestFormat(r) == views.FormatJSON {\n")
+				buf.WriteString("\t\tviews.JSON(w, http.StatusCreated, record)\n")
+				buf.WriteString("\t\treturn\n")
+				buf.WriteString("\t}\n")
+				buf.WriteString(fmt.Sprintf("\tsession.SetFlash(w, r, session.FlashNotice, \"%s was created.\")\n", label))
 			}
 			buf.WriteString(fmt.Sprintf("\thttp.Redirect(w, r, \"/%s\", http.StatusSeeOther)\n", toSnakeCase(name)))
 			buf.WriteString("}\n\n")
@@ -556,9 +576,9 @@ func createControllerFile(name string, actions []string) error {
 				buf.WriteString("\tidStr := r.PathValue(\"id\")\n")
 				buf.WriteString("\tid, _ := strconv.Atoi(idStr)\n")
 				buf.WriteString(fmt.Sprintf("\trecord, _ := models.Get%sByID(db.GetDB(), uint(id))\n", modelName))
-				buf.WriteString(fmt.Sprintf("\tviews.Render(w, \"%s_edit.html.tmpl\", record)\n", toSnakeCase(name)))
+				buf.WriteString(fmt.Sprintf("\tviews.Respond(w, r, http.StatusOK, \"%s_edit.html.tmpl\", record)\n", toSnakeCase(name)))
 			} else {
-				buf.WriteString(fmt.Sprintf("\tviews.Render(w, \"%s_edit.html.tmpl\", nil)\n", toSnakeCase(name)))
+				buf.WriteString(fmt.Sprintf("\tviews.Respond(w, r, http.StatusOK, \"%s_edit.html.tmpl\", nil)\n", toSnakeCase(name)))
 			}
 			buf.WriteString("}\n\n")
 		case "update":
@@ -568,7 +588,14 @@ func createControllerFile(name string, actions []string) error {
 				buf.WriteString("\tid, _ := strconv.Atoi(idStr)\n")
 				buf.WriteString(fmt.Sprintf("\trecord, _ := models.Get%sByID(db.GetDB(), uint(id))\n", modelName))
 				buf.WriteString("\t// TODO: update record fields\n")
-				buf.WriteString(fmt.Sprintf("\t_ = models.Update%s(db.GetDB(), record)\n", modelName))
+				buf.WriteString(fmt.Sprintf("\tif err := models.Update%s(db.GetDB(), record); err != nil {\n", modelName))
+				writeSaveError(&buf, label+" could not be saved", fmt.Sprintf("\"/%s/\"+idStr+\"/edit\"", toSnakeCase(name)))
+				buf.WriteString("\t}\n")
+				buf.WriteString("\tif views.RequestFormat(r) == views.FormatJSON {\n")
+				buf.WriteString("\t\tviews.JSON(w, http.StatusOK, record)\n")
+				buf.WriteString("\t\treturn\n")
+				buf.WriteString("\t}\n")
+				buf.WriteString(fmt.Sprintf("\tsession.SetFlash(w, r, session.FlashNotice, \"%s was saved.\")\n", label))
 				buf.WriteString(fmt.Sprintf("\thttp.Redirect(w, r, \"/%s/\"+idStr, http.StatusSeeOther)\n", toSnakeCase(name)))
 			} else {
 				buf.WriteString(fmt.Sprintf("\thttp.Redirect(w, r, \"/%s\", http.StatusSeeOther)\n", toSnakeCase(name)))
@@ -579,7 +606,14 @@ func createControllerFile(name string, actions []string) error {
 			if hasModel {
 				buf.WriteString("\tidStr := r.PathValue(\"id\")\n")
 				buf.WriteString("\tid, _ := strconv.Atoi(idStr)\n")
-				buf.WriteString(fmt.Sprintf("\t_ = models.Delete%s(db.GetDB(), uint(id))\n", modelName))
+				buf.WriteString(fmt.Sprintf("\tif err := models.Delete%s(db.GetDB(), uint(id)); err != nil {\n", modelName))
+				writeSaveError(&buf, label+" could not be deleted", fmt.Sprintf("\"/%s/\"+idStr", toSnakeCase(name)))
+				buf.WriteString("\t}\n")
+				buf.WriteString("\tif views.RequestFormat(r) == views.FormatJSON {\n")
+				buf.WriteString("\t\tw.WriteHeader(http.StatusNoContent)\n")
+				buf.WriteString("\t\treturn\n")
+				buf.WriteString("\t}\n")
+				buf.WriteString(fmt.Sprintf("\tsession.SetFlash(w, r, session.FlashNotice, \"%s was deleted.\")\n", label))
 			}
 			buf.WriteString(fmt.Sprintf("\thttp.Redirect(w, r, \"/%s\", http.StatusSeeOther)\n", toSnakeCase(name)))
 			buf.WriteString("}\n\n")
@@ -597,6 +631,19 @@ func createControllerFile(name string, actions []string) error {
 	return nil
 }
 
+// writeSaveError writes the body of a generated `if err != nil` block for a
+// failed save: JSON clients get the error, browsers a flash alert and a
+// redirect to target, a Go expression.
+func writeSaveError(buf *bytes.Buffer, message, target string) {
+	buf.WriteString("\t\tif views.RequestFormat(r) == views.FormatJSON {\n")
+	buf.WriteString("\t\t\tviews.JSON(w, http.StatusUnprocessableEntity, map[string]string{\"error\": err.Error()})\n")
+	buf.WriteString("\t\t\treturn\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString(fmt.Sprintf("\t\tsession.SetFlash(w, r, session.FlashAlert, \"%s: \"+err.Error())\n", message))
+	buf.WriteString(fmt.Sprintf("\t\thttp.Redirect(w, r, %s, http.StatusSeeOther)\n", target))
+	buf.WriteString("\t\treturn\n")
+}
+
 // updateRoutesFile injects new routes for the controller actions.
 func updateRoutesFile(name string, actions []string) error {
 	path := filepath.Join("app", "routes", "routes.go")
@@ -1095,15 +1142,16 @@ func createAuthControllerFile() error {
 	buf.WriteString("\t\"net/http\"\n\n")
 	buf.WriteString("\t\"monolith/db\"\n")
 	buf.WriteString("\t\"monolith/app/models\"\n")
+	buf.WriteString("\t\"monolith/app/session\"\n")
 	buf.WriteString("\t\"monolith/app/views\"\n")
 	buf.WriteString(")\n\n")
 	buf.WriteString("type AuthController struct{}\n\n")
 	buf.WriteString("var AuthCtrl = &AuthController{}\n\n")
 	buf.WriteString("func (ac *AuthController) ShowLoginForm(w http.ResponseWriter, r *http.Request) {\n")
-	buf.WriteString("\tviews.Render(w, \"auth_login.html.tmpl\", nil)\n")
+	buf.WriteString("\tviews.HTML(w, r, http.StatusOK, \"auth_login.html.tmpl\", nil)\n")
 	buf.WriteString("}\n\n")
 	buf.WriteString("func (ac *AuthController) ShowSignupForm(w http.ResponseWriter, r *http.Request) {\n")
-	buf.WriteString("\tviews.Render(w, \"auth_signup.html.tmpl\", nil)\n")
+	buf.WriteString("\tviews.HTML(w, r, http.StatusOK, \"auth_signup.html.tmpl\", nil)\n")
 	buf.WriteString("}\n\n")
 	buf.WriteString("func (ac *AuthController) Signup(w http.ResponseWriter, r *http.Request) {\n")
 	buf.WriteString("\tif err := r.ParseForm(); err != nil {\n")
@@ -1113,14 +1161,17 @@ func createAuthControllerFile() error {
 	buf.WriteString("\temail := r.FormValue(\"email\")\n")
 	buf.WriteString("\tpassword := r.FormValue(\"password\")\n")
 	buf.WriteString("\tif email == \"\" || password == \"\" {\n")
-	buf.WriteString("\t\thttp.Error(w, \"missing credentials\", http.StatusBadRequest)\n")
+	buf.WriteString("\t\tsession.SetFlash(w, r, session.FlashAlert, \"Email and password are required.\")\n")
+	buf.WriteString("\t\thttp.Redirect(w, r, \"/signup\", http.StatusSeeOther)\n")
 	buf.WriteString("\t\treturn\n")
 	buf.WriteString("\t}\n")
 	buf.WriteString("\tif _, err := models.CreateUser(db.GetDB(), email, password); err != nil {\n")
-	buf.WriteString("\t\thttp.Error(w, \"could not create user\", http.StatusInternalServerError)\n")
+	buf.WriteString("\t\tsession.SetFlash(w, r, session.FlashAlert, \"Could not create an account with that email.\")\n")
+	buf.WriteString("\t\thttp.Redirect(w, r, \"/signup\", http.StatusSeeOther)\n")
 	buf.WriteString("\t\treturn\n")
 	buf.WriteString("\t}\n")
 	buf.WriteString("\tmodels.SetLoggedIn(w, r, email)\n")
+	buf.WriteString("\tsession.SetFlash(w, r, session.FlashNotice, \"Welcome! Your account was created.\")\n")
 	buf.WriteString("\thttp.Redirect(w, r, \"/\", http.StatusSeeOther)\n")
 	buf.WriteString("}\n\n")
 	buf.WriteString("func (ac *AuthController) Login(w http.ResponseWriter, r *http.Request) {\n")
@@ -1131,14 +1182,17 @@ func createAuthControllerFile() error {
 	buf.WriteString("\temail := r.FormValue(\"email\")\n")
 	buf.WriteString("\tpassword := r.FormValue(\"password\")\n")
 	buf.WriteString("\tif _, err := models.AuthenticateUser(db.GetDB(), email, password); err != nil {\n")
-	buf.WriteString("\t\thttp.Error(w, \"invalid credentials\", http.StatusUnauthorized)\n")
+	buf.WriteString("\t\tsession.SetFlash(w, r, session.FlashAlert, \"Invalid email or password.\")\n")
+	buf.WriteString("\t\thttp.Redirect(w, r, \"/login\", http.StatusSeeOther)\n")
 	buf.WriteString("\t\treturn\n")
 	buf.WriteString("\t}\n")
 	buf.WriteString("\tmodels.SetLoggedIn(w, r, email)\n")
+	buf.WriteString("\tsession.SetFlash(w, r, session.FlashNotice, \"You are logged in.\")\n")
 	buf.WriteString("\thttp.Redirect(w, r, \"/\", http.StatusSeeOther)\n")
 	buf.WriteString("}\n\n")
 	buf.WriteString("func (ac *AuthController) Logout(w http.ResponseWriter, r *http.Request) {\n")
 	buf.WriteString("\tmodels.Logout(w, r)\n")
+	buf.WriteString("\tsession.SetFlash(w, r, session.FlashNotice, \"You are logged out.\")\n")
 	buf.WriteString("\thttp.Redirect(w, r, \"/\", http.StatusSeeOther)\n")
 	buf.WriteString("}\n")
 	formatted, err := format.Source(buf.Bytes())
@@ -1264,7 +1318,8 @@ func updateRoutesForAuth() error {
 	lines = ensureControllersImport(lines)
 	insertIdx := -1
 	for i, line := range lines {
-		if strings.Contains(line, "staticFileServer") {
+		// after the static files route
+		if strings.Contains(line, "assets.Handler()") || strings.Contains(line, "staticFileServer") {
 			insertIdx = i + 1
 			break
 		}
@@ -1756,7 +1811,7 @@ func createAdminControllerFile() error {
 	buf.WriteString("\t\tdata[\"columns\"] = colNames\n")
 	buf.WriteString("\t\tdata[\"rows\"] = rows\n")
 	buf.WriteString("\t}\n")
-	buf.WriteString("\tviews.Render(w, \"admin_dashboard.html.tmpl\", data)\n")
+	buf.WriteString("\tviews.HTML(w, r, http.StatusOK, \"admin_dashboard.html.tmpl\", data)\n")
 	buf.WriteString("}\n")
 	formatted, err := format.Source(buf.Bytes())
 	if err != nil {
@@ -186,9 +186,17 @@ func TestRunResource(t *testing.T) {
 	if _, err := os.Stat("app/models/gadget.go"); err != nil {
 		t.Fatalf("model: %v", err)
 	}
-	if _, err := os.Stat("app/controllers/gadgets_controller.go"); err != nil {
+	ctrl, err := os.ReadFile("app/controllers/gadgets_controller.go")
+	if err != nil {
 		t.Fatalf("controller: %v", err)
 	}
+	if !strings.Contains(string(ctrl), `views.Respond(w, r, http.StatusOK, "gadgets_show.html.tmpl", record)`) ||
+		!strings.Contains(string(ctrl), "views.JSON(w, http.StatusCreated, record)") {
+		t.Fatalf("controller does not respond by format:\n%s", ctrl)
+	}
+	if !strings.Contains(string(ctrl), `session.SetFlash(w, r, session.FlashNotice, "Gadget was created.")`) {
+		t.Fatalf("controller does not flash:\n%s", ctrl)
+	}
 }
 
 func TestRunJob(t *testing.T) {
@@ -20,7 +20,9 @@ import (
 //go:embed static/*
 var staticFiles embed.FS
 
-//go:embed app/views/**
+// all: keeps partials, whose names start with "_", in subdirectories.
+//
+//go:embed all:app/views
 var templateFiles embed.FS
 
 func main() {
@@ -59,8 +61,13 @@ func main() {
 	// initialize job queue, must come after initializing the database
 	jobs.InitJobQueue()
 
-	// initialize templates
-	views.InitTemplates(templateFiles)
+	// initialize templates, read from disk in development so template edits
+	// show up without a rebuild
+	if config.IsDevelopment() {
+		views.InitReloadingTemplates(os.DirFS("."))
+	} else {
+		views.InitTemplates(templateFiles)
+	}
 
 	// initialize the websocket pub/sub
 	ws.InitPubSub()
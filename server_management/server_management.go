@@ -12,6 +12,7 @@ import (
 	"log/slog"
 	"monolith/app/config"
 	"monolith/app/routes"
+	"monolith/ws"
 	"net/http"
 	"os"
 	"os/signal"
@@ -38,6 +39,14 @@ func RunServer(staticFiles embed.FS) {
 		<-sig
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
+		// WebSocket connections are hijacked and invisible to
+		// server.Shutdown, so close them first; that also ends SSE streams,
+		// which server.Shutdown would otherwise wait on.
+		if ws.HUB != nil {
+			if err := ws.HUB.Shutdown(ctx); err != nil {
+				slog.Error("pub/sub shutdown", "error", err)
+			}
+		}
 		if err := server.Shutdown(ctx); err != nil {
 			slog.Error("HTTP shutdown", "error", err)
 		}
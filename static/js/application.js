@@ -0,0 +1,425 @@
+// Monolith's browser client for the WebSocket hub in ws/.
+//
+//   const cable = Monolith.connect();
+//   const unsubscribe = cable.subscribe("chat:lobby", {
+//     received: (payload, envelope) => console.log(payload),
+//     join: identity => console.log(identity, "joined"),
+//   });
+//   cable.send("chat:lobby", "Hello!");
+//   cable.call("orders.total", { id: 42 }).then(total => console.log(total));
+//
+// Binary data (an ArrayBuffer or typed array) passed to send goes out in a
+// binary frame, and binary messages arrive in received as a Uint8Array.
+//
+// The client reconnects with exponential backoff, subscribes again after every
+// reconnect (asking the hub to replay what was missed since the last message
+// it saw on each channel), and queues messages sent while offline until the
+// connection is back.
+//
+// Live page updates use the same client: any element with a
+// data-stream-channel attribute subscribes the page to that channel, and
+// streams broadcast from Go with ws.BroadcastStream ("stream" envelopes with
+// an {"action", "target", "html"} payload) are applied to the element whose
+// id is the target. Only the server can send streams; ordinary messages are
+// never applied as HTML:
+//
+//   <ul id="messages" data-stream-channel="messages">...</ul>
+(function () {
+  "use strict";
+
+  var defaults = {
+    url: null, // defaults to /ws on the current host
+    minDelay: 500, // first reconnect delay in ms
+    maxDelay: 30000, // cap on the reconnect delay in ms
+    queueLimit: 100, // outbound messages kept while offline
+    replayLimit: 0, // cap on replayed messages per channel, 0 for the hub's
+    callTimeout: 10000, // ms before a call is rejected, also sent to the hub
+  };
+
+  // matches reports whether channel matches a subscription name, following the
+  // hub's wildcard rules: a "*" segment matches one segment, and a trailing "*"
+  // matches one or more.
+  function matches(name, channel) {
+    if (name === channel) {
+      return true;
+    }
+    var want = name.split(":");
+    var got = channel.split(":");
+    for (var i = 0; i < want.length; i++) {
+      if (want[i] === "*" && i === want.length - 1) {
+        return got.length > i;
+      }
+      if (i >= got.length || (want[i] !== "*" && want[i] !== got[i])) {
+        return false;
+      }
+    }
+    return want.length === got.length;
+  }
+
+  // Binary frames are a JSON header, a newline, then the raw bytes.
+  var newline = 10;
+
+  function isBinary(data) {
+    return data instanceof ArrayBuffer || ArrayBuffer.isView(data);
+  }
+
+  function bytes(data) {
+    if (data instanceof ArrayBuffer) {
+      return new Uint8Array(data);
+    }
+    return new Uint8Array(data.buffer, data.byteOffset, data.byteLength);
+  }
+
+  function encodeBinary(header, data) {
+    var head = new TextEncoder().encode(JSON.stringify(header));
+    var frame = new Uint8Array(head.length + 1 + data.length);
+    frame.set(head);
+    frame[head.length] = newline;
+    frame.set(data, head.length + 1);
+    return frame;
+  }
+
+  // decodeBinary returns the envelope of a binary frame with the raw bytes as
+  // its payload.
+  function decodeBinary(buffer) {
+    var frame = new Uint8Array(buffer);
+    var i = frame.indexOf(newline);
+    if (i === -1) {
+      throw new Error("binary frame without header");
+    }
+    var envelope = JSON.parse(new TextDecoder().decode(frame.subarray(0, i)));
+    envelope.payload = frame.slice(i + 1);
+    return envelope;
+  }
+
+  function Client(options) {
+    this.options = Object.assign({}, defaults, options);
+    if (!this.options.url) {
+      var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+      this.options.url = scheme + location.host + "/ws";
+    }
+    // subscriptions maps a channel name or pattern to its callbacks and the ID
+    // of the last message received on it.
+    this.subscriptions = {};
+    this.outbox = [];
+    // calls maps the ref of each unanswered call to its promise callbacks.
+    this.calls = {};
+    this.nextRef = 1;
+    this.listeners = {};
+    this.attempts = 0;
+    this.closed = false;
+    this.socket = null;
+    this.timer = null;
+    this.open();
+  }
+
+  Client.prototype.open = function () {
+    var self = this;
+    var socket = new WebSocket(this.options.url);
+    socket.binaryType = "arraybuffer";
+    this.socket = socket;
+    socket.onopen = function () {
+      self.attempts = 0;
+      Object.keys(self.subscriptions).forEach(function (name) {
+        self.write(self.subscribeCommand(name));
+      });
+      var pending = self.outbox;
+      self.outbox = [];
+      pending.forEach(function (command) {
+        self.write(command);
+        if (command.ref && self.calls[command.ref]) {
+          self.calls[command.ref].sent = true;
+        }
+      });
+      self.emit("connected");
+    };
+    socket.onmessage = function (ev) {
+      var envelope;
+      try {
+        envelope = typeof ev.data === "string" ? JSON.parse(ev.data) : decodeBinary(ev.data);
+      } catch (e) {
+        return;
+      }
+      self.dispatch(envelope);
+    };
+    socket.onclose = function () {
+      self.socket = null;
+      // The hub cancels a connection's calls when it drops, so calls already
+      // sent will never be answered. Queued ones go out after reconnecting.
+      Object.keys(self.calls).forEach(function (ref) {
+        if (self.calls[ref].sent) {
+          self.settle(ref, new Error("disconnected"));
+        }
+      });
+      self.emit("disconnected");
+      if (!self.closed) {
+        self.reconnect();
+      }
+    };
+  };
+
+  // reconnect schedules the next connection attempt. Delays double from
+  // minDelay up to maxDelay, with jitter so clients dropped together don't all
+  // come back at once.
+  Client.prototype.reconnect = function () {
+    var self = this;
+    var delay = Math.min(this.options.maxDelay, this.options.minDelay * Math.pow(2, this.attempts));
+    delay = delay / 2 + Math.random() * delay / 2;
+    this.attempts++;
+    this.timer = setTimeout(function () {
+      self.timer = null;
+      self.open();
+    }, delay);
+  };
+
+  Client.prototype.connected = function () {
+    return this.socket !== null && this.socket.readyState === WebSocket.OPEN;
+  };
+
+  Client.prototype.write = function (command) {
+    if (command.binary) {
+      this.socket.send(encodeBinary({ command: command.command, identifier: command.identifier }, command.binary));
+      return;
+    }
+    this.socket.send(JSON.stringify(command));
+  };
+
+  Client.prototype.subscribeCommand = function (name) {
+    var command = { command: "subscribe", identifier: name };
+    var last = this.subscriptions[name].last;
+    if (last) {
+      command.since = last;
+    }
+    if (this.options.replayLimit) {
+      command.limit = this.options.replayLimit;
+    }
+    return command;
+  };
+
+  // subscribe listens on a channel or wildcard pattern. callbacks is either a
+  // function called for every message, or an object with any of received,
+  // stream, subscribed, unsubscribed, join, leave, truncated (the replay after
+  // a reconnect skipped messages) and error. It returns a function that
+  // unsubscribes.
+  Client.prototype.subscribe = function (name, callbacks) {
+    var self = this;
+    if (typeof callbacks === "function") {
+      callbacks = { received: callbacks };
+    }
+    var sub = this.subscriptions[name];
+    if (sub) {
+      sub.callbacks.push(callbacks);
+    } else {
+      sub = { callbacks: [callbacks], last: 0 };
+      this.subscriptions[name] = sub;
+      if (this.connected()) {
+        this.write(this.subscribeCommand(name));
+      }
+    }
+    return function () {
+      var i = sub.callbacks.indexOf(callbacks);
+      if (i !== -1) {
+        sub.callbacks.splice(i, 1);
+      }
+      if (sub.callbacks.length === 0 && self.subscriptions[name] === sub) {
+        delete self.subscriptions[name];
+        if (self.connected()) {
+          self.write({ command: "unsubscribe", identifier: name });
+        }
+      }
+    };
+  };
+
+  // send broadcasts data on channel. An ArrayBuffer or typed array is sent as
+  // binary, a string as text, and anything else as JSON, which subscribers
+  // receive decoded. While offline the message is queued, oldest dropped past
+  // queueLimit.
+  Client.prototype.send = function (channel, data) {
+    var command = { command: "message", identifier: channel };
+    if (isBinary(data)) {
+      // Copied so later changes to the caller's buffer don't leak into a
+      // queued message.
+      command.binary = bytes(data).slice();
+    } else if (typeof data === "string") {
+      command.data = data;
+    } else {
+      command.data = JSON.stringify(data);
+      command.encoding = "json";
+    }
+    if (this.connected()) {
+      this.write(command);
+      return;
+    }
+    this.outbox.push(command);
+    if (this.outbox.length > this.options.queueLimit) {
+      this.outbox.shift();
+    }
+  };
+
+  // call invokes a method registered on the hub with HandleCall and returns a
+  // promise of its result. data is sent like send's; options.timeout (ms)
+  // overrides callTimeout. The promise rejects with the hub's error, on
+  // timeout, or if the connection drops before the reply arrives.
+  Client.prototype.call = function (method, data, options) {
+    var self = this;
+    var timeout = (options && options.timeout) || this.options.callTimeout;
+    if (data === undefined) {
+      data = "";
+    } else if (typeof data !== "string") {
+      data = JSON.stringify(data);
+    }
+    var ref = String(this.nextRef++);
+    var command = { command: "call", identifier: method, ref: ref, data: data, timeout: timeout };
+    return new Promise(function (resolve, reject) {
+      var pending = { resolve: resolve, reject: reject, sent: false };
+      pending.timer = setTimeout(function () {
+        self.outbox = self.outbox.filter(function (queued) { return queued !== command; });
+        self.settle(ref, new Error("timeout"));
+      }, timeout);
+      self.calls[ref] = pending;
+      if (self.connected()) {
+        pending.sent = true;
+        self.write(command);
+      } else {
+        self.outbox.push(command);
+      }
+    });
+  };
+
+  // settle resolves or, when err is set, rejects the call ref.
+  Client.prototype.settle = function (ref, err, result) {
+    var pending = this.calls[ref];
+    if (!pending) {
+      return;
+    }
+    delete this.calls[ref];
+    clearTimeout(pending.timer);
+    if (err) {
+      pending.reject(err);
+    } else {
+      pending.resolve(result);
+    }
+  };
+
+  // on registers a connection-level callback: "connected", "disconnected", or
+  // "error" for error frames that aren't about a subscribed channel.
+  Client.prototype.on = function (event, fn) {
+    (this.listeners[event] = this.listeners[event] || []).push(fn);
+  };
+
+  Client.prototype.emit = function (event) {
+    var args = Array.prototype.slice.call(arguments, 1);
+    (this.listeners[event] || []).forEach(function (fn) { fn.apply(null, args); });
+  };
+
+  // close disconnects for good; the client won't reconnect.
+  Client.prototype.close = function () {
+    this.closed = true;
+    clearTimeout(this.timer);
+    if (this.socket) {
+      this.socket.close();
+    }
+  };
+
+  Client.prototype.dispatch = function (envelope) {
+    var self = this;
+    if (envelope.ref) {
+      this.settle(envelope.ref, envelope.type === "error" ? new Error(envelope.error) : null, envelope.payload);
+      return;
+    }
+    var channel = envelope.channel || "";
+    var handled = false;
+    Object.keys(this.subscriptions).forEach(function (name) {
+      var sub = self.subscriptions[name];
+      var exact = name === channel;
+      if (envelope.type === "message" || envelope.type === "stream") {
+        if (!matches(name, channel)) {
+          return;
+        }
+        // Replays and live delivery can overlap around a reconnect; the hub
+        // delivers stored messages in ID order (even across processes, see
+        // ws/backplane.go), so anything at or below the last one seen is a
+        // duplicate.
+        if (envelope.id) {
+          if (envelope.id <= sub.last) {
+            return;
+          }
+          sub.last = envelope.id;
+        }
+        self.invoke(sub, envelope.type === "stream" ? "stream" : "received", envelope.payload, envelope);
+      } else if (exact) {
+        if (envelope.type === "error") {
+          handled = true;
+          self.invoke(sub, "error", envelope.error, envelope);
+        } else if (envelope.type === "join" || envelope.type === "leave") {
+          // Presence payloads are {"identity": ...}; callbacks get the
+          // identity itself.
+          self.invoke(sub, envelope.type, envelope.payload && envelope.payload.identity, envelope);
+        } else {
+          self.invoke(sub, envelope.type, envelope.payload, envelope);
+        }
+      }
+    });
+    if (envelope.type === "error" && !handled) {
+      this.emit("error", envelope.error, envelope);
+    }
+  };
+
+  Client.prototype.invoke = function (sub, name, arg, envelope) {
+    sub.callbacks.slice().forEach(function (callbacks) {
+      if (typeof callbacks[name] === "function") {
+        callbacks[name](arg, envelope);
+      }
+    });
+  };
+
+  function fragment(html) {
+    return document.createRange().createContextualFragment(html || "");
+  }
+
+  var actions = {
+    append: function (el, html) { el.append(fragment(html)); },
+    prepend: function (el, html) { el.prepend(fragment(html)); },
+    replace: function (el, html) { el.replaceWith(fragment(html)); },
+    update: function (el, html) { el.replaceChildren(fragment(html)); },
+    remove: function (el) { el.remove(); },
+  };
+
+  // applyStream applies one stream to the document. It returns false when the
+  // action is unknown or the target isn't on the page.
+  function applyStream(stream) {
+    var action = actions[stream.action];
+    var el = document.getElementById(stream.target);
+    if (!action || !el) {
+      return false;
+    }
+    action(el, stream.html);
+    return true;
+  }
+
+  var Monolith = window.Monolith = window.Monolith || {};
+  var shared = null;
+
+  // connect returns a new client. Monolith.cable() returns one client shared by
+  // the whole page, which is usually what you want.
+  Monolith.connect = function (options) { return new Client(options); };
+  Monolith.cable = function () {
+    if (!shared) {
+      shared = new Client();
+    }
+    return shared;
+  };
+  Monolith.applyStream = applyStream;
+
+  document.addEventListener("DOMContentLoaded", function () {
+    var seen = {};
+    document.querySelectorAll("[data-stream-channel]").forEach(function (el) {
+      var channel = el.getAttribute("data-stream-channel");
+      if (seen[channel]) {
+        return;
+      }
+      seen[channel] = true;
+      Monolith.cable().subscribe(channel, { stream: applyStream });
+    });
+  });
+})();
@@ -0,0 +1,166 @@
+package ws
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"monolith/app/session"
+)
+
+// Action is an operation a client performs on a channel.
+type Action string
+
+const (
+	ActionSubscribe Action = "subscribe"
+	ActionPublish   Action = "publish"
+)
+
+// ErrForbidden is returned by authorizers that deny an operation without a
+// more specific reason.
+var ErrForbidden = errors.New("forbidden")
+
+// Authorizer decides whether the client behind an upgrade request may perform
+// an action on a channel. Returning nil allows it; the error text of a denial
+// is sent back to the client in an error frame.
+type Authorizer interface {
+	Authorize(r *http.Request, channel string, action Action) error
+}
+
+// AuthorizerFunc adapts an ordinary function to the Authorizer interface.
+type AuthorizerFunc func(r *http.Request, channel string, action Action) error
+
+// Authorize calls f(r, channel, action).
+func (f AuthorizerFunc) Authorize(r *http.Request, channel string, action Action) error {
+	return f(r, channel, action)
+}
+
+// Identify returns the identity of the user behind a request, or "" for an
+// anonymous client. The default reads the email stored in the session by the
+// authentication generator. Replace it during startup if your app tracks users
+// differently.
+var Identify = SessionIdentity
+
+// SessionIdentity returns the logged in user's email from the session.
+func SessionIdentity(r *http.Request) string {
+	return session.LoggedInEmail(r)
+}
+
+// Rule grants access to the channels matching Pattern.
+//
+// Patterns are split into segments on ":". A "{name}" segment matches any
+// single segment and captures it under name, and a trailing "*" matches any
+// remaining segments. For example "user:{id}" matches "user:42" and
+// "chat:*" matches "chat:lobby" and "chat:team:7".
+type Rule struct {
+	Pattern string
+	// Actions limits the rule to the listed actions. Empty means all actions.
+	Actions []Action
+	// Allow reports whether the request may access the matched channel. The
+	// params map holds the captured pattern segments. A nil Allow permits
+	// every request.
+	Allow func(r *http.Request, params map[string]string) bool
+}
+
+// Rules is an Authorizer made of an ordered list of rules. The first rule that
+// matches both the channel and the action decides; channels without a
+// matching rule are denied.
+type Rules []Rule
+
+// Authorize implements Authorizer.
+func (rs Rules) Authorize(r *http.Request, channel string, action Action) error {
+	for _, rule := range rs {
+		if !rule.covers(action) {
+			continue
+		}
+		params, ok := matchPattern(rule.Pattern, channel)
+		if !ok {
+			continue
+		}
+		if rule.Allow == nil || rule.Allow(r, params) {
+			return nil
+		}
+		return ErrForbidden
+	}
+	return ErrForbidden
+}
+
+func (rule Rule) covers(action Action) bool {
+	if len(rule.Actions) == 0 {
+		return true
+	}
+	for _, a := range rule.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIdentity returns a Rule.Allow func that only admits the user whose
+// identity (see Identify) equals the captured param, e.g. a "user:{id}" rule
+// built with MatchIdentity("id") limits each user to their own channel.
+func MatchIdentity(param string) func(r *http.Request, params map[string]string) bool {
+	return func(r *http.Request, params map[string]string) bool {
+		id := Identify(r)
+		return id != "" && params[param] == id
+	}
+}
+
+// LoggedIn is a Rule.Allow func that admits any identified user.
+func LoggedIn(r *http.Request, params map[string]string) bool {
+	return Identify(r) != ""
+}
+
+// matchPattern reports whether channel matches pattern and returns the
+// captured "{name}" segments. The channel may itself be a wildcard
+// subscription such as "orders:*"; its "*" segments are compared like any
+// other, so rules decide on the pattern as a whole.
+func matchPattern(pattern, channel string) (map[string]string, bool) {
+	ps := strings.Split(pattern, ":")
+	cs := strings.Split(channel, ":")
+	params := map[string]string{}
+	for i, p := range ps {
+		if p == "*" && i == len(ps)-1 {
+			return params, len(cs) >= len(ps)
+		}
+		if i >= len(cs) {
+			return nil, false
+		}
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			// A trailing wildcard in a subscription spans any number of
+			// segments, so only a trailing "*" in the rule may cover it.
+			if cs[i] == "" || (cs[i] == "*" && i == len(cs)-1) {
+				return nil, false
+			}
+			params[p[1:len(p)-1]] = cs[i]
+			continue
+		}
+		if p != cs[i] {
+			return nil, false
+		}
+	}
+	return params, len(cs) == len(ps)
+}
+
+// SetAuthorizer installs the authorizer consulted for client subscribe and
+// publish commands. Call it during startup, before serving requests. A nil
+// authorizer (the default) allows everything.
+func (h *Hub) SetAuthorizer(a Authorizer) {
+	h.authorizer = a
+}
+
+// authorize checks whether client c may perform action on channel.
+func (h *Hub) authorize(c *Client, channel string, action Action) error {
+	if h.authorizer == nil {
+		return nil
+	}
+	return h.authorizer.Authorize(c.request, channel, action)
+}
+
+// reject tells the client that a command on channel was denied.
+func (c *Client) reject(command, channel string, reason error) {
+	slog.Warn("websocket command rejected", "command", command, "channel", channel, "reason", reason)
+	c.sendError(command, channel, reason)
+}
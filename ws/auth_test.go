@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"monolith/app/session"
+)
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, channel string
+		ok               bool
+		id               string
+	}{
+		{"user:{id}", "user:42", true, "42"},
+		{"user:{id}", "user:42:extra", false, ""},
+		{"user:{id}", "user:", false, ""},
+		{"chat:*", "chat:lobby", true, ""},
+		{"chat:*", "chat:team:7", true, ""},
+		{"chat:*", "chat", false, ""},
+		{"lobby", "lobby", true, ""},
+		{"lobby", "lobby2", false, ""},
+		{"user:{id}", "user:*", false, ""},
+		{"orders:*", "orders:*", true, ""},
+	}
+	for _, tc := range cases {
+		params, ok := matchPattern(tc.pattern, tc.channel)
+		if ok != tc.ok {
+			t.Fatalf("%s vs %s: expected %v", tc.pattern, tc.channel, tc.ok)
+		}
+		if ok && params["id"] != tc.id {
+			t.Fatalf("%s vs %s: expected id %q, got %q", tc.pattern, tc.channel, tc.id, params["id"])
+		}
+	}
+}
+
+func TestRulesAuthorize(t *testing.T) {
+	rules := Rules{
+		{Pattern: "user:{id}", Allow: MatchIdentity("id")},
+		{Pattern: "news", Actions: []Action{ActionSubscribe}},
+	}
+
+	anon := httptest.NewRequest("GET", "/ws", nil)
+	if err := rules.Authorize(anon, "news", ActionSubscribe); err != nil {
+		t.Fatalf("expected news subscribe allowed: %v", err)
+	}
+	if err := rules.Authorize(anon, "news", ActionPublish); err == nil {
+		t.Fatalf("expected news publish denied")
+	}
+	if err := rules.Authorize(anon, "user:a@example.com", ActionSubscribe); err == nil {
+		t.Fatalf("expected anonymous user channel denied")
+	}
+
+	req := loggedInRequest(t, "a@example.com")
+	if err := rules.Authorize(req, "user:a@example.com", ActionSubscribe); err != nil {
+		t.Fatalf("expected own channel allowed: %v", err)
+	}
+	if err := rules.Authorize(req, "user:b@example.com", ActionSubscribe); err == nil {
+		t.Fatalf("expected other user's channel denied")
+	}
+}
+
+func TestDeniedSubscribeSendsRejection(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.SetAuthorizer(AuthorizerFunc(func(r *http.Request, channel string, action Action) error {
+		if channel == "secret" {
+			return ErrForbidden
+		}
+		return nil
+	}))
+	conn := dial(t, h)
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "secret"})
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var msg Envelope
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if msg.Type != TypeError || msg.Channel != "secret" || msg.Command != "subscribe" || msg.Error != "forbidden" {
+		t.Fatalf("unexpected rejection %#v", msg)
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.channels["secret"]) != 0 {
+		t.Fatalf("denied client was subscribed")
+	}
+}
+
+// loggedInRequest returns a request carrying a session cookie for email.
+func loggedInRequest(t *testing.T, email string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	s, _ := session.GetSession(r)
+	s.Values[session.LOGGED_IN_KEY] = true
+	s.Values[session.EMAIL_KEY] = email
+	if err := s.Save(r, w); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	return req
+}
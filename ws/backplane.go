@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"monolith/app/models"
+)
+
+// DefaultBackplaneInterval is how often the backplane polls the messages
+// table. It bounds how long a broadcast takes to reach other processes.
+const DefaultBackplaneInterval = 250 * time.Millisecond
+
+// backplaneBatch caps how many messages one poll delivers.
+const backplaneBatch = 500
+
+// newOrigin returns an identifier for this process that is unique across
+// restarts, e.g. "web1-4242-9f86d081".
+func newOrigin() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// StartBackplane makes the hub deliver messages broadcast by other processes
+// that share its database. Every hub already stores its broadcasts in the
+// messages table, tagged with its origin; the backplane tails that table every
+// interval and fans out rows written by other origins to local subscribers.
+//
+// Each hub delivers stored messages in ID order, which clients rely on to
+// skip duplicates and to resume after a reconnect: before delivering its own
+// broadcasts the hub first delivers the rows other processes stored with
+// lower IDs, instead of leaving them to the next poll.
+//
+// Only messages stored after the backplane starts are delivered. Message IDs
+// must increase in commit order, which holds for SQLite's single writer; with
+// a database where concurrent inserts can commit out of ID order a late row
+// may be skipped.
+func (h *Hub) StartBackplane(interval time.Duration) {
+	if h.db == nil {
+		slog.Warn("websocket backplane needs a database, not starting")
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultBackplaneInterval
+	}
+	var last uint
+	if err := h.db.Model(&models.Message{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		slog.Error("websocket backplane start failed", "error", err)
+		return
+	}
+	slog.Info("Starting websocket backplane", "origin", h.origin, "interval", interval)
+	select {
+	case h.backplaneStart <- last:
+	case <-h.done:
+		return
+	}
+	go h.tail(interval)
+}
+
+// tail asks the hub loop to poll for messages from other processes every
+// interval.
+func (h *Hub) tail(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+		// A poll still pending covers this tick too.
+		select {
+		case h.backplanePoll <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// pullRemote returns the messages other processes stored since the last
+// call, oldest first, stopping before ID below unless below is 0. It must run
+// on the hub goroutine.
+func (h *Hub) pullRemote(below uint) []BroadcastMessage {
+	if !h.backplane {
+		return nil
+	}
+	var out []BroadcastMessage
+	for {
+		q := h.db.Where("id > ? AND origin <> ? AND is_active = ?", h.remoteLast, h.origin, true)
+		if below > 0 {
+			q = q.Where("id < ?", below)
+		}
+		var msgs []models.Message
+		if err := q.Order("id").Limit(backplaneBatch).Find(&msgs).Error; err != nil {
+			slog.Error("websocket backplane poll failed", "error", err)
+			return out
+		}
+		for _, m := range msgs {
+			out = append(out, storedMessage(m))
+			h.remoteLast = m.ID
+		}
+		if len(msgs) < backplaneBatch {
+			return out
+		}
+	}
+}
+
+// deliverInOrder delivers a freshly stored batch after any remote messages
+// with lower IDs, so local subscribers see IDs in increasing order.
+func (h *Hub) deliverInOrder(batch []BroadcastMessage) {
+	var newest uint
+	for _, msg := range batch {
+		newest = max(newest, msg.id)
+	}
+	var remote []BroadcastMessage
+	if newest > 0 {
+		remote = h.pullRemote(newest)
+	}
+	for _, msg := range batch {
+		// Unstored messages have no ID and go out in batch order.
+		for len(remote) > 0 && msg.id != 0 && remote[0].id < msg.id {
+			h.deliver(remote[0])
+			remote = remote[1:]
+		}
+		h.deliver(msg)
+	}
+	for _, msg := range remote {
+		h.deliver(msg)
+	}
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"monolith/app/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// sharedDB opens a database file that several hubs can share, like
+// processes would.
+func sharedDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "shared.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Message{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestBackplaneFansOutAcrossHubs(t *testing.T) {
+	db := sharedDB(t)
+	a, b := NewHub(db), NewHub(db)
+	go a.Run()
+	go b.Run()
+	a.Broadcast("room", []byte("before start"))
+	time.Sleep(20 * time.Millisecond)
+	a.StartBackplane(10 * time.Millisecond)
+	b.StartBackplane(10 * time.Millisecond)
+
+	onA := newTestClient(a, 10)
+	onB := newTestClient(b, 10)
+	a.register <- Subscription{client: onA, channel: "room"}
+	b.register <- Subscription{client: onB, channel: "room"}
+	time.Sleep(20 * time.Millisecond)
+
+	a.Broadcast("room", []byte("from a"))
+	b.Broadcast("room", []byte("from b"))
+	time.Sleep(100 * time.Millisecond)
+
+	for name, c := range map[string]*Client{"a": onA, "b": onB} {
+		got := map[string]int{}
+		for len(c.send) > 0 {
+			got[string((<-c.send).Data)]++
+		}
+		if got["from a"] != 1 || got["from b"] != 1 || len(got) != 2 {
+			t.Fatalf("client on %s got %v, want each message exactly once", name, got)
+		}
+	}
+}
+
+func TestBackplaneDeliversInIDOrder(t *testing.T) {
+	db := sharedDB(t)
+	a, b := NewHub(db), NewHub(db)
+	go a.Run()
+	go b.Run()
+	// No poll fires during the test: only catching up before a local
+	// broadcast can deliver b's message on a.
+	a.StartBackplane(time.Hour)
+	b.StartBackplane(time.Hour)
+	onA := &Client{hub: a, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	a.register <- Subscription{client: onA, channel: "room"}
+	time.Sleep(20 * time.Millisecond)
+
+	b.Broadcast("room", []byte("from b"))
+	time.Sleep(20 * time.Millisecond)
+	a.Broadcast("room", []byte("from a"))
+	time.Sleep(20 * time.Millisecond)
+
+	var got []string
+	var last uint
+	for _, e := range drain(t, onA) {
+		if e.ID <= last {
+			t.Fatalf("IDs out of order: %d after %d", e.ID, last)
+		}
+		last = e.ID
+		got = append(got, string(e.Payload))
+	}
+	if want := []string{`"from b"`, `"from a"`}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestBackplaneSkipsInactiveMessages(t *testing.T) {
+	db := sharedDB(t)
+	h := NewHub(db)
+	h.backplane = true
+	for _, content := range []string{"shown", "hidden"} {
+		m := models.Message{Channel: "room", Content: content, IsActive: true, Origin: "elsewhere"}
+		if err := db.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&models.Message{}).Where("content = ?", "hidden").Update("is_active", false)
+
+	msgs := h.pullRemote(0)
+	if len(msgs) != 1 || string(msgs[0].data) != "shown" {
+		t.Fatalf("expected only the active message, got %v", msgs)
+	}
+}
@@ -0,0 +1,144 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log/slog"
+
+	"monolith/app/models"
+)
+
+// Binary messages travel in binary WebSocket frames laid out as a JSON header,
+// a newline, then the raw bytes. Clients publish with the usual message
+// command as the header:
+//
+//	{"command":"message","identifier":"avatars:42"}\n<bytes>
+//
+// and receive the usual envelope, with "encoding":"binary" and no payload, as
+// the header:
+//
+//	{"v":1,"type":"message","channel":"avatars:42","id":7,"ts":"...","encoding":"binary"}\n<bytes>
+//
+// Compact JSON never contains a raw newline, so the first one ends the
+// header. Clients of the raw format get the bytes alone in a binary frame, and
+// SSE streams, which can only carry text, get the envelope with the payload as
+// a base64 string and "encoding":"base64".
+
+// Payload encodings named in Envelope.Encoding.
+const (
+	EncodingBinary = "binary"
+	EncodingBase64 = "base64"
+)
+
+// EncodingJSON is the encoding of a message command whose data is a JSON
+// value to be sent as is; see payload.
+const EncodingJSON = "json"
+
+// Frame is one WebSocket message queued for a client.
+type Frame struct {
+	Data []byte
+	// Binary frames are sent as binary WebSocket messages, everything else as
+	// text.
+	Binary bool
+}
+
+// text wraps a text frame.
+func text(data []byte) Frame {
+	return Frame{Data: data}
+}
+
+// splitBinary splits a binary frame into its JSON header and payload. It
+// reports false if there is no header.
+func splitBinary(message []byte) (header, data []byte, ok bool) {
+	i := bytes.IndexByte(message, '\n')
+	if i < 0 {
+		return nil, nil, false
+	}
+	return message[:i], message[i+1:], true
+}
+
+// joinBinary lays out a binary frame.
+func joinBinary(header, data []byte) []byte {
+	out := make([]byte, 0, len(header)+1+len(data))
+	out = append(out, header...)
+	out = append(out, '\n')
+	return append(out, data...)
+}
+
+// BroadcastBinary sends data to every client subscribed to channel as a
+// binary message. It can be called from any goroutine.
+func (h *Hub) BroadcastBinary(channel string, data []byte) {
+	select {
+	case h.broadcast <- BroadcastMessage{channel: channel, data: data, binary: true}:
+	case <-h.done:
+	}
+}
+
+// record returns msg as a row for the messages table. Binary content is
+// stored base64-encoded so it fits a text column on every database.
+func (msg BroadcastMessage) record(origin string) models.Message {
+	m := models.Message{
+		IsActive:  true,
+		Channel:   msg.channel,
+		Content:   string(msg.data),
+		Binary:    msg.binary,
+		JSON:      msg.json,
+		Stream:    msg.stream,
+		CreatedAt: msg.createdAt,
+		Origin:    origin,
+	}
+	if msg.binary {
+		m.Content = base64.StdEncoding.EncodeToString(msg.data)
+	}
+	return m
+}
+
+// storedMessage turns a row of the messages table back into a broadcast.
+func storedMessage(m models.Message) BroadcastMessage {
+	msg := BroadcastMessage{
+		channel:   m.Channel,
+		data:      []byte(m.Content),
+		id:        m.ID,
+		createdAt: m.CreatedAt,
+		binary:    m.Binary,
+		json:      m.JSON,
+		stream:    m.Stream,
+	}
+	if m.Binary {
+		data, err := base64.StdEncoding.DecodeString(m.Content)
+		if err != nil {
+			slog.Error("invalid stored binary message", "id", m.ID, "error", err)
+		}
+		msg.data = data
+	}
+	return msg
+}
+
+// Compression configures permessage-deflate. Browsers negotiate it during the
+// handshake; once agreed, frames of at least Threshold bytes are compressed.
+type Compression struct {
+	Enabled bool
+	// Level is the flate level from 1 (fastest) to 9 (smallest). Zero means
+	// the default, 1.
+	Level int
+	// Threshold is the smallest frame, in bytes, worth compressing. Zero
+	// means DefaultCompressionThreshold.
+	Threshold int
+}
+
+// DefaultCompressionThreshold is the frame size below which compression
+// costs more than it saves.
+const DefaultCompressionThreshold = 1024
+
+// SetCompression sets whether and how frames sent to clients are compressed.
+// It is off by default. Call it during startup, before serving requests.
+func (h *Hub) SetCompression(c Compression) {
+	h.compression = c
+}
+
+func (h *Hub) compressionThreshold() int {
+	if h.compression.Threshold > 0 {
+		return h.compression.Threshold
+	}
+	return DefaultCompressionThreshold
+}
@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"monolith/app/models"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBinaryStoredAndReplayed(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	go h.Run()
+	data := []byte{0, 1, '\n', 0xff}
+	h.BroadcastBinary("files", data)
+	time.Sleep(50 * time.Millisecond)
+
+	var m models.Message
+	if err := db.First(&m).Error; err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if !m.Binary || m.Content != base64.StdEncoding.EncodeToString(data) {
+		t.Fatalf("unexpected stored message %+v", m)
+	}
+
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	raw := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool), legacy: true}
+	sse := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool), textOnly: true}
+	for _, client := range []*Client{c, raw, sse} {
+		h.register <- Subscription{client: client, channel: "files", since: &Cursor{}}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	frame := <-c.send
+	header, got, ok := splitBinary(frame.Data)
+	if !frame.Binary || !ok {
+		t.Fatalf("expected a binary frame, got %q", frame.Data)
+	}
+	var e Envelope
+	if err := json.Unmarshal(header, &e); err != nil {
+		t.Fatalf("decode header: %v", err)
+	}
+	if e.Encoding != EncodingBinary || e.ID != m.ID || e.Payload != nil || !bytes.Equal(got, data) {
+		t.Fatalf("unexpected envelope %+v with data %v", e, got)
+	}
+
+	if frame := <-raw.send; !frame.Binary || !bytes.Equal(frame.Data, data) {
+		t.Fatalf("expected raw binary data, got %+v", frame)
+	}
+
+	frame = <-sse.send
+	if frame.Binary {
+		t.Fatalf("SSE clients can't receive binary frames")
+	}
+	if err := json.Unmarshal(frame.Data, &e); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	var encoded string
+	json.Unmarshal(e.Payload, &encoded)
+	if e.Encoding != EncodingBase64 || encoded != m.Content {
+		t.Fatalf("expected a base64 payload, got %s", frame.Data)
+	}
+}
+
+func TestBinaryPublish(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	conn := dial(t, h)
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "files"})
+	readEnvelope(t, conn)
+
+	data := []byte{0xca, 0xfe, '\n'}
+	conn.WriteMessage(websocket.BinaryMessage,
+		joinBinary([]byte(`{"command":"message","identifier":"files"}`), data))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	_, got, _ := splitBinary(message)
+	if messageType != websocket.BinaryMessage || !bytes.Equal(got, data) {
+		t.Fatalf("expected the data back in a binary frame, got %q", message)
+	}
+
+	conn.WriteMessage(websocket.BinaryMessage, data[:2])
+	if e := readEnvelope(t, conn); e.Type != TypeError || e.Error != errInvalidCommand.Error() {
+		t.Fatalf("expected an invalid command error, got %#v", e)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	h := NewHub(setupDB(t))
+	h.SetCompression(Compression{Enabled: true, Threshold: 64})
+	go h.Run()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWs))
+	defer srv.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("compression not negotiated, extensions %q", ext)
+	}
+
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "news"})
+	readEnvelope(t, conn)
+	large := strings.Repeat("a", 4096)
+	h.Broadcast("news", []byte("small"))
+	h.Broadcast("news", []byte(large))
+	if e := readEnvelope(t, conn); string(e.Payload) != `"small"` {
+		t.Fatalf("unexpected payload %s", e.Payload)
+	}
+	if e := readEnvelope(t, conn); string(e.Payload) != `"`+large+`"` {
+		t.Fatalf("large payload garbled")
+	}
+}
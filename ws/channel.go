@@ -0,0 +1,185 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var errPatternHandled = errors.New("wildcard covers channels with server-side logic, subscribe to them by name")
+
+// Channel is server-side logic attached to pub/sub channels, in the spirit of
+// ActionCable channels. Register one with Hub.HandleChannel and the hub calls
+// it for client commands on matching channels:
+//
+//   - Subscribed runs before a client joins. Returning an error rejects the
+//     subscription and the error is sent to the client.
+//   - Received runs for every message a client publishes. The data is not
+//     broadcast automatically; call ctx.Broadcast to fan it out (possibly
+//     after validating, storing or transforming it). Returning an error sends
+//     it back to the sender.
+//   - Unsubscribed runs when the client unsubscribes or disconnects.
+//
+// Callbacks run on the client's connection goroutine, so a slow callback only
+// delays that client.
+type Channel interface {
+	Subscribed(ctx *Context) error
+	Received(ctx *Context, data []byte) error
+	Unsubscribed(ctx *Context)
+}
+
+// Context describes the client and channel a Channel callback runs for.
+type Context struct {
+	// Channel is the concrete channel name, e.g. "chat:lobby".
+	Channel string
+	// Params holds the segments captured by the pattern the Channel was
+	// registered under, e.g. {"room": "lobby"} for "chat:{room}".
+	Params map[string]string
+	// Identity is the logged in user behind the connection, if any.
+	Identity string
+	// Request is the HTTP request the connection was opened with.
+	Request *http.Request
+	// Binary is set in Received when the client published the data in a
+	// binary frame.
+	Binary bool
+	// JSON is set in Received when the client published the data as a JSON
+	// value ("encoding": "json") rather than text.
+	JSON bool
+
+	client *Client
+}
+
+// Reply sends data on the context's channel to the calling client only. The
+// message is not stored.
+func (ctx *Context) Reply(data []byte) {
+	out := newFrames(BroadcastMessage{channel: ctx.Channel, data: data, createdAt: time.Now().UTC()})
+	ctx.client.queue(out.forClient(ctx.client))
+}
+
+// Broadcast sends data to every subscriber of the context's channel.
+func (ctx *Context) Broadcast(data []byte) {
+	ctx.client.hub.Broadcast(ctx.Channel, data)
+}
+
+// BroadcastJSON sends v, encoded as JSON, to every subscriber of the
+// context's channel. Data the client published as JSON can be passed on as
+// json.RawMessage(data).
+func (ctx *Context) BroadcastJSON(v interface{}) error {
+	return ctx.client.hub.BroadcastJSON(ctx.Channel, v)
+}
+
+// BroadcastBinary sends data to every subscriber of the context's channel as
+// a binary message.
+func (ctx *Context) BroadcastBinary(data []byte) {
+	ctx.client.hub.BroadcastBinary(ctx.Channel, data)
+}
+
+// BroadcastTo sends data to every subscriber of another channel.
+func (ctx *Context) BroadcastTo(channel string, data []byte) {
+	ctx.client.hub.Broadcast(channel, data)
+}
+
+// Hub returns the hub the client is connected to.
+func (ctx *Context) Hub() *Hub {
+	return ctx.client.hub
+}
+
+// channelHandler pairs a Channel with the pattern it was registered under.
+type channelHandler struct {
+	pattern string
+	channel Channel
+}
+
+// HandleChannel registers ch for the channels matching pattern. The pattern is
+// an exact channel name or uses the syntax of Rule patterns ("chat:*",
+// "room:{id}"). Exact names win over patterns; otherwise the first matching
+// registration is used. Call it during startup, before serving requests.
+func (h *Hub) HandleChannel(pattern string, ch Channel) {
+	h.handlers = append(h.handlers, channelHandler{pattern: pattern, channel: ch})
+}
+
+// channelFor returns the Channel registered for channel, if any.
+func (h *Hub) channelFor(channel string) (Channel, map[string]string) {
+	for _, hd := range h.handlers {
+		if hd.pattern == channel {
+			return hd.channel, map[string]string{}
+		}
+	}
+	for _, hd := range h.handlers {
+		if params, ok := matchPattern(hd.pattern, channel); ok {
+			return hd.channel, params
+		}
+	}
+	return nil, nil
+}
+
+func (c *Client) context(channel string, params map[string]string) *Context {
+	return &Context{
+		Channel:  channel,
+		Params:   params,
+		Identity: c.identity,
+		Request:  c.request,
+		client:   c,
+	}
+}
+
+// subscribed runs the Subscribed callback for channel, if it has a Channel.
+// Wildcard subscriptions are refused when they cover channels with a Channel:
+// its Subscribed callback decides per channel, and a pattern would get their
+// messages without asking it.
+func (c *Client) subscribed(channel string) error {
+	if isPattern(channel) {
+		for _, hd := range c.hub.handlers {
+			if patternsOverlap(channel, hd.pattern) {
+				return errPatternHandled
+			}
+		}
+		return nil
+	}
+	ch, params := c.hub.channelFor(channel)
+	if ch == nil {
+		return nil
+	}
+	if _, ok := c.handled[channel]; ok {
+		return nil
+	}
+	if err := ch.Subscribed(c.context(channel, params)); err != nil {
+		return err
+	}
+	if c.handled == nil {
+		c.handled = make(map[string]Channel)
+	}
+	c.handled[channel] = ch
+	return nil
+}
+
+// received hands a published message to the channel's Channel. It reports
+// false when the channel has none and the message should be broadcast as is.
+func (c *Client) received(channel string, data []byte, binary, isJSON bool) (bool, error) {
+	ch, params := c.hub.channelFor(channel)
+	if ch == nil {
+		return false, nil
+	}
+	ctx := c.context(channel, params)
+	ctx.Binary, ctx.JSON = binary, isJSON
+	return true, ch.Received(ctx, data)
+}
+
+// unsubscribed runs the Unsubscribed callback for channel if Subscribed ran.
+func (c *Client) unsubscribed(channel string) {
+	ch, ok := c.handled[channel]
+	if !ok {
+		return
+	}
+	delete(c.handled, channel)
+	_, params := c.hub.channelFor(channel)
+	ch.Unsubscribed(c.context(channel, params))
+}
+
+// unsubscribedAll runs the Unsubscribed callbacks of every handled channel
+// when the connection goes away.
+func (c *Client) unsubscribedAll() {
+	for channel := range c.handled {
+		c.unsubscribed(channel)
+	}
+}
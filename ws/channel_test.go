@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shoutChannel upper-cases chat messages and refuses the "closed" room.
+type shoutChannel struct {
+	left chan string
+}
+
+func (s *shoutChannel) Subscribed(ctx *Context) error {
+	if ctx.Params["room"] == "closed" {
+		return errors.New("room is closed")
+	}
+	ctx.Reply([]byte("welcome"))
+	return nil
+}
+
+func (s *shoutChannel) Received(ctx *Context, data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty message")
+	}
+	ctx.Broadcast(bytes.ToUpper(data))
+	return nil
+}
+
+func (s *shoutChannel) Unsubscribed(ctx *Context) {
+	s.left <- ctx.Channel
+}
+
+func readEnvelope(t *testing.T, conn *websocket.Conn) Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var e Envelope
+	if err := conn.ReadJSON(&e); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return e
+}
+
+func TestChannelCallbacks(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	shout := &shoutChannel{left: make(chan string, 1)}
+	h.HandleChannel("chat:{room}", shout)
+	conn := dial(t, h)
+
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "chat:closed"})
+	if e := readEnvelope(t, conn); e.Type != TypeError || e.Error != "room is closed" {
+		t.Fatalf("expected rejection, got %#v", e)
+	}
+
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "chat:lobby"})
+	if e := readEnvelope(t, conn); e.Type != TypeMessage || string(e.Payload) != `"welcome"` {
+		t.Fatalf("expected welcome reply, got %#v", e)
+	}
+	if e := readEnvelope(t, conn); e.Type != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %#v", e)
+	}
+
+	conn.WriteJSON(map[string]string{"command": "message", "identifier": "chat:lobby", "data": "hello"})
+	if e := readEnvelope(t, conn); e.Type != TypeMessage || string(e.Payload) != `"HELLO"` || e.ID == 0 {
+		t.Fatalf("expected transformed broadcast, got %#v", e)
+	}
+
+	conn.WriteJSON(map[string]string{"command": "message", "identifier": "chat:lobby", "data": ""})
+	if e := readEnvelope(t, conn); e.Type != TypeError || e.Error != "empty message" {
+		t.Fatalf("expected error frame, got %#v", e)
+	}
+
+	conn.Close()
+	select {
+	case ch := <-shout.left:
+		if ch != "chat:lobby" {
+			t.Fatalf("unexpected unsubscribed channel %q", ch)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Unsubscribed not called on disconnect")
+	}
+}
+
+func TestWildcardCannotBypassChannel(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.HandleChannel("chat:{room}", &shoutChannel{left: make(chan string, 10)})
+	conn := dial(t, h)
+
+	for _, pattern := range []string{"chat:*", "*", "*:closed"} {
+		conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": pattern})
+		if e := readEnvelope(t, conn); e.Type != TypeError || e.Error != errPatternHandled.Error() {
+			t.Fatalf("%s: expected rejection, got %#v", pattern, e)
+		}
+	}
+	// Patterns that can't reach a handled channel are fine.
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "news:*"})
+	if e := readEnvelope(t, conn); e.Type != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %#v", e)
+	}
+
+	h.Broadcast("chat:closed", []byte("secret"))
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	var e Envelope
+	if err := conn.ReadJSON(&e); err == nil {
+		t.Fatalf("rejected client got %#v", e)
+	}
+}
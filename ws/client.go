@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"log/slog"
+
+	"github.com/gorilla/websocket"
+)
+
+// SlowConsumerPolicy decides what happens when a client's send buffer is full
+// because it isn't reading as fast as messages arrive.
+type SlowConsumerPolicy int
+
+const (
+	// Disconnect evicts the client from every channel and closes its
+	// connection. This is the default.
+	Disconnect SlowConsumerPolicy = iota
+	// DropNewest discards the frame that doesn't fit and keeps the client.
+	DropNewest
+	// DropOldest discards the oldest queued frame to make room for the new
+	// one, so the client always sees the most recent messages.
+	DropOldest
+)
+
+func (p SlowConsumerPolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop_newest"
+	case DropOldest:
+		return "drop_oldest"
+	default:
+		return "disconnect"
+	}
+}
+
+// SetSlowConsumerPolicy sets how the hub treats clients whose send buffer is
+// full. Call it during startup, before serving requests.
+func (h *Hub) SetSlowConsumerPolicy(p SlowConsumerPolicy) {
+	h.slowConsumer = p
+}
+
+// queue adds a frame to the client's send buffer, applying the hub's slow
+// consumer policy when the buffer is full. It is safe to call from any
+// goroutine and reports false once the client is closed or has just been
+// disconnected for being too slow.
+func (c *Client) queue(frame Frame) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- frame:
+		return true
+	default:
+	}
+
+	policy := c.hub.slowConsumer
+	slog.Warn("slow websocket consumer", "policy", policy.String())
+	switch policy {
+	case DropNewest:
+		return true
+	case DropOldest:
+		// The writer may drain the buffer concurrently, so retry until the
+		// frame fits.
+		for {
+			select {
+			case <-c.send:
+			default:
+			}
+			select {
+			case c.send <- frame:
+				return true
+			default:
+			}
+		}
+	default:
+		c.closeLocked()
+		return false
+	}
+}
+
+// close marks the client closed and closes its send channel, which tells the
+// writer to send a close frame and hang up. Calling it more than once is safe;
+// the channel is only closed the first time.
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked()
+}
+
+func (c *Client) closeLocked() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.send)
+}
+
+// isClosed reports whether the client has been closed.
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// setCloseReason sets the status and reason of the close frame sent when the
+// client is closed. Without one the close frame is empty.
+func (c *Client) setCloseReason(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeCode = code
+	c.closeReason = reason
+}
+
+// closeMessage returns the payload of the client's close frame.
+func (c *Client) closeMessage() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeCode == 0 {
+		return []byte{}
+	}
+	return websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+}
+
+// removeClient drops c from every channel it is subscribed to and closes it.
+// It runs on the hub goroutine and is a no-op for clients already removed.
+func (h *Hub) removeClient(c *Client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	var left []string
+	for channel := range c.subscriptions {
+		h.removeSubscription(c, channel)
+		left = append(left, channel)
+	}
+	h.mu.Unlock()
+	for _, channel := range left {
+		h.leave(channel, c)
+	}
+	c.close()
+}
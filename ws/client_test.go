@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestClient(h *Hub, buffer int) *Client {
+	return &Client{hub: h, send: make(chan Frame, buffer), subscriptions: make(map[string]bool), legacy: true}
+}
+
+func TestSlowConsumerDisconnectLeavesAllChannels(t *testing.T) {
+	h := NewHub(nil)
+	go h.Run()
+	slow := newTestClient(h, 1)
+	h.register <- Subscription{client: slow, channel: "a"}
+	h.register <- Subscription{client: slow, channel: "b"}
+	time.Sleep(10 * time.Millisecond)
+
+	h.Broadcast("a", []byte("1"))
+	h.Broadcast("a", []byte("2")) // doesn't fit: evicted
+	h.Broadcast("b", []byte("3")) // must not panic on the closed channel
+	time.Sleep(20 * time.Millisecond)
+
+	if !slow.isClosed() {
+		t.Fatalf("slow client not closed")
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.channels["a"]) != 0 || len(h.channels["b"]) != 0 {
+		t.Fatalf("slow client still subscribed: %v", h.channels)
+	}
+	if got := string((<-slow.send).Data); got != "1" {
+		t.Fatalf("expected queued frame 1, got %q", got)
+	}
+	if _, ok := <-slow.send; ok {
+		t.Fatalf("send channel not closed")
+	}
+}
+
+func TestSlowConsumerDropPolicies(t *testing.T) {
+	cases := []struct {
+		policy SlowConsumerPolicy
+		want   []string
+	}{
+		{DropNewest, []string{"1", "2"}},
+		{DropOldest, []string{"3", "4"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			h := NewHub(nil)
+			h.SetSlowConsumerPolicy(tc.policy)
+			go h.Run()
+			c := newTestClient(h, 2)
+			h.register <- Subscription{client: c, channel: "a"}
+			time.Sleep(10 * time.Millisecond)
+			for _, m := range []string{"1", "2", "3", "4"} {
+				h.Broadcast("a", []byte(m))
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			if c.isClosed() {
+				t.Fatalf("client should stay connected")
+			}
+			for _, w := range tc.want {
+				if got := string((<-c.send).Data); got != w {
+					t.Fatalf("expected %q, got %q", w, got)
+				}
+			}
+		})
+	}
+}
+
+// TestConcurrentTeardown exercises broadcasts, evictions and disconnects at
+// the same time; run with -race.
+func TestConcurrentTeardown(t *testing.T) {
+	h := NewHub(nil)
+	go h.Run()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		c := newTestClient(h, 1)
+		for j := 0; j < 3; j++ {
+			h.register <- Subscription{client: c, channel: fmt.Sprintf("ch%d", j), identity: fmt.Sprint(i)}
+		}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 5; k++ {
+				c.queue(text([]byte("reply")))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			h.disconnect <- c
+		}()
+	}
+	for k := 0; k < 50; k++ {
+		h.Broadcast(fmt.Sprintf("ch%d", k%3), []byte("x"))
+	}
+	wg.Wait()
+	time.Sleep(20 * time.Millisecond)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for channel, clients := range h.channels {
+		if len(clients) != 0 {
+			t.Fatalf("channel %s still has %d clients", channel, len(clients))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package ws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// ProtocolVersion is the version of the envelope format sent to clients.
+const ProtocolVersion = 1
+
+// Envelope types sent from the server to clients.
+const (
+	TypeMessage = "message"
+	// TypeStream carries a live page update (see Stream). Only the server
+	// sends streams, so clients can trust their HTML.
+	TypeStream       = "stream"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeError        = "error"
+)
+
+// Envelope is the JSON frame the server sends to clients. Every frame carries
+// the protocol version and a type; message frames also carry the channel, the
+// stored message ID and the payload, while error frames name the command that
+// failed and why.
+//
+//	{"v":1,"type":"message","channel":"chat","id":42,"ts":"2024-01-02T15:04:05Z","payload":"hi"}
+//	{"v":1,"type":"subscribed","channel":"chat","ts":"2024-01-02T15:04:05Z"}
+//	{"v":1,"type":"error","channel":"secret","command":"subscribe","error":"forbidden","ts":"..."}
+type Envelope struct {
+	Version   int             `json:"v"`
+	Type      string          `json:"type"`
+	Channel   string          `json:"channel,omitempty"`
+	ID        uint            `json:"id,omitempty"`
+	Timestamp time.Time       `json:"ts"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Command   string          `json:"command,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	// Ref echoes the correlation ID of the call a result or error answers.
+	Ref string `json:"ref,omitempty"`
+	// Encoding is set for binary messages: EncodingBinary when the payload
+	// follows the envelope in a binary frame, EncodingBase64 when Payload is
+	// the base64 string of the data.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// payload returns a message's data as the JSON value of its envelope. JSON
+// messages are embedded as is; text is always sent as a JSON string, so "42"
+// stays a string rather than turning into a number.
+func payload(msg BroadcastMessage) json.RawMessage {
+	if msg.json {
+		return msg.data
+	}
+	encoded, _ := json.Marshal(string(msg.data))
+	return encoded
+}
+
+// encode marshals an envelope, stamping the version and a timestamp if unset.
+func (e Envelope) encode() []byte {
+	e.Version = ProtocolVersion
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("encode envelope", "error", err)
+	}
+	return data
+}
+
+// frames holds a broadcast message encoded for every client format so the
+// hub only encodes it once however many clients receive it.
+type frames struct {
+	envelope Frame
+	raw      Frame
+	// text is the envelope of a binary message for clients that can only
+	// receive text (SSE streams). It equals envelope for text messages.
+	text Frame
+}
+
+// newFrames encodes msg as a message (or stream) envelope and as raw data.
+func newFrames(msg BroadcastMessage) frames {
+	e := Envelope{
+		Type:      TypeMessage,
+		Channel:   msg.channel,
+		ID:        msg.id,
+		Timestamp: msg.createdAt,
+	}
+	if msg.stream {
+		e.Type = TypeStream
+	}
+	if !msg.binary {
+		e.Payload = payload(msg)
+		f := text(e.encode())
+		return frames{envelope: f, raw: text(msg.data), text: f}
+	}
+	b64 := e
+	b64.Encoding = EncodingBase64
+	b64.Payload, _ = json.Marshal(base64.StdEncoding.EncodeToString(msg.data))
+	e.Encoding = EncodingBinary
+	return frames{
+		envelope: Frame{Data: joinBinary(e.encode(), msg.data), Binary: true},
+		raw:      Frame{Data: msg.data, Binary: true},
+		text:     text(b64.encode()),
+	}
+}
+
+// forClient returns the frame matching the client's format.
+func (f frames) forClient(c *Client) Frame {
+	switch {
+	case c.legacy:
+		return f.raw
+	case c.textOnly:
+		return f.text
+	default:
+		return f.envelope
+	}
+}
+
+// notify queues a control frame (confirmation or error) for the client.
+// Legacy clients only receive errors.
+func (c *Client) notify(e Envelope) {
+	if c.legacy && e.Type != TypeError {
+		return
+	}
+	c.queue(text(e.encode()))
+}
+
+// sendError tells the client that a command failed.
+func (c *Client) sendError(command, channel string, reason error) {
+	c.notify(Envelope{Type: TypeError, Channel: channel, Command: command, Error: reason.Error()})
+}
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPayloadEncoding(t *testing.T) {
+	if got := string(payload(BroadcastMessage{data: []byte(`{"a":1}`), json: true})); got != `{"a":1}` {
+		t.Fatalf("json payload changed: %s", got)
+	}
+	for _, text := range []string{"hello", "42", "true", "null", `"quoted"`, `{"a":1}`} {
+		var got string
+		if err := json.Unmarshal(payload(BroadcastMessage{data: []byte(text)}), &got); err != nil || got != text {
+			t.Fatalf("text %q came back as %q (%v)", text, got, err)
+		}
+	}
+}
+
+func TestBroadcastSendsEnvelope(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: c, channel: "room", ack: true}
+	time.Sleep(10 * time.Millisecond)
+	h.Broadcast("room", []byte("hi"))
+	time.Sleep(20 * time.Millisecond)
+
+	var ack, msg Envelope
+	if err := json.Unmarshal((<-c.send).Data, &ack); err != nil {
+		t.Fatalf("decode ack: %v", err)
+	}
+	if ack.Type != TypeSubscribed || ack.Channel != "room" || ack.Version != ProtocolVersion {
+		t.Fatalf("unexpected ack %#v", ack)
+	}
+	if err := json.Unmarshal((<-c.send).Data, &msg); err != nil {
+		t.Fatalf("decode message: %v", err)
+	}
+	if msg.Type != TypeMessage || msg.Channel != "room" || msg.ID == 0 || msg.Timestamp.IsZero() {
+		t.Fatalf("unexpected envelope %#v", msg)
+	}
+	if string(msg.Payload) != `"hi"` {
+		t.Fatalf("unexpected payload %s", msg.Payload)
+	}
+}
+
+func TestLegacyClientGetsRawData(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool), legacy: true}
+	h.register <- Subscription{client: c, channel: "room", ack: true}
+	time.Sleep(10 * time.Millisecond)
+	h.Broadcast("room", []byte("hi"))
+	time.Sleep(20 * time.Millisecond)
+
+	if got := string((<-c.send).Data); got != "hi" {
+		t.Fatalf("expected raw data, got %q", got)
+	}
+	if len(c.send) != 0 {
+		t.Fatalf("legacy client should not receive confirmations")
+	}
+}
+
+func TestMessageEncodings(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	conn := dial(t, h)
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "room"})
+	if e := readEnvelope(t, conn); e.Type != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %#v", e)
+	}
+
+	tests := []struct {
+		command map[string]string
+		want    string
+	}{
+		{map[string]string{"data": "42"}, `"42"`},
+		{map[string]string{"data": `"quoted"`}, `"\"quoted\""`},
+		{map[string]string{"data": "42", "encoding": EncodingJSON}, `42`},
+		{map[string]string{"data": `{"a":[1,true,null]}`, "encoding": EncodingJSON}, `{"a":[1,true,null]}`},
+	}
+	for _, tt := range tests {
+		tt.command["command"], tt.command["identifier"] = "message", "room"
+		conn.WriteJSON(tt.command)
+		if e := readEnvelope(t, conn); e.Type != TypeMessage || string(e.Payload) != tt.want {
+			t.Fatalf("%v: expected payload %s, got %#v", tt.command, tt.want, e)
+		}
+	}
+
+	conn.WriteJSON(map[string]string{"command": "message", "identifier": "room", "data": "{", "encoding": EncodingJSON})
+	if e := readEnvelope(t, conn); e.Type != TypeError || e.Error != errInvalidJSON.Error() {
+		t.Fatalf("expected invalid JSON to be rejected, got %#v", e)
+	}
+
+	if err := h.BroadcastJSON("room", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if e := readEnvelope(t, conn); string(e.Payload) != `{"n":1}` {
+		t.Fatalf("unexpected JSON broadcast %#v", e)
+	}
+	// Stored messages replay with the same encoding.
+	stored, _ := h.history("room", nil, 0)
+	if got := string(payload(storedMessage(stored[len(stored)-1]))); got != `{"n":1}` {
+		t.Fatalf("replayed JSON payload %s", got)
+	}
+}
@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultReadLimit is the largest frame, in bytes, a client may send unless
+// the hub is given another limit with SetReadLimit.
+const DefaultReadLimit = 64 << 10
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// RateLimit is a token bucket: commands are allowed at PerSecond on average,
+// with bursts of up to Burst commands. The zero value means no limit.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.PerSecond > 0 && l.Burst > 0
+}
+
+// bucket is a token bucket for one connection or identity.
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	// refs counts the connections sharing an identity's bucket.
+	refs int
+}
+
+func newBucket(limit RateLimit) *bucket {
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// refill adds the tokens earned since the last call.
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.PerSecond
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+}
+
+// allow takes a token if one is available.
+func (b *bucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// SetReadLimit sets the largest frame, in bytes, a client may send. Larger
+// frames close the connection with status 1009 (message too big). Call it
+// during startup, before serving requests.
+func (h *Hub) SetReadLimit(n int64) {
+	h.readLimit = n
+}
+
+// SetClientRateLimit limits how many commands each connection may send.
+// Call it during startup, before serving requests.
+func (h *Hub) SetClientRateLimit(l RateLimit) {
+	h.clientLimit = l
+}
+
+// SetIdentityRateLimit limits how many commands each logged in user may send
+// across all of their connections. Call it during startup, before serving
+// requests.
+func (h *Hub) SetIdentityRateLimit(l RateLimit) {
+	h.identityLimit = l
+}
+
+func (h *Hub) maxMessageSize() int64 {
+	if h.readLimit > 0 {
+		return h.readLimit
+	}
+	return DefaultReadLimit
+}
+
+// identityBuckets holds the buckets of identities with open connections.
+type identityBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// acquire returns identity's bucket, creating it if needed, and counts one
+// more connection using it.
+func (ib *identityBuckets) acquire(identity string, limit RateLimit) *bucket {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if ib.buckets == nil {
+		ib.buckets = make(map[string]*bucket)
+	}
+	b, ok := ib.buckets[identity]
+	if !ok {
+		b = newBucket(limit)
+		ib.buckets[identity] = b
+	}
+	b.refs++
+	return b
+}
+
+// release counts one connection less for identity. Buckets without
+// connections are forgotten once full again, since a fresh bucket is the
+// same; until then they are kept so reconnecting doesn't reset the limit.
+func (ib *identityBuckets) release(identity string) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if b, ok := ib.buckets[identity]; ok {
+		b.refs--
+	}
+	now := time.Now()
+	for id, b := range ib.buckets {
+		if b.refs > 0 {
+			continue
+		}
+		if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+			delete(ib.buckets, id)
+		}
+	}
+}
+
+func (ib *identityBuckets) allow(b *bucket) bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return b.allow(time.Now())
+}
+
+// limiter enforces the hub's rate limits for one client. It is only used by
+// the client's reading goroutine.
+type limiter struct {
+	hub      *Hub
+	client   *bucket
+	identity *bucket
+	name     string
+}
+
+func (h *Hub) newLimiter(identity string) *limiter {
+	l := &limiter{hub: h, name: identity}
+	if h.clientLimit.enabled() {
+		l.client = newBucket(h.clientLimit)
+	}
+	if identity != "" && h.identityLimit.enabled() {
+		l.identity = h.identityBuckets.acquire(identity, h.identityLimit)
+	}
+	return l
+}
+
+// allow reports whether the client may run one more command.
+func (l *limiter) allow() bool {
+	if l.client != nil && !l.client.allow(time.Now()) {
+		return false
+	}
+	if l.identity != nil && !l.hub.identityBuckets.allow(l.identity) {
+		return false
+	}
+	return true
+}
+
+// stop releases the identity's bucket when the connection goes away.
+func (l *limiter) stop() {
+	if l.identity != nil {
+		l.hub.identityBuckets.release(l.name)
+	}
+}
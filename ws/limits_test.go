@@ -0,0 +1,117 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBucket(t *testing.T) {
+	b := newBucket(RateLimit{PerSecond: 10, Burst: 2})
+	now := b.last
+	if !b.allow(now) || !b.allow(now) {
+		t.Fatal("burst should be allowed")
+	}
+	if b.allow(now) {
+		t.Fatal("third command in a burst of two allowed")
+	}
+	if !b.allow(now.Add(100 * time.Millisecond)) {
+		t.Fatal("token not refilled after 100ms at 10/s")
+	}
+}
+
+func TestIdentityBucketsShared(t *testing.T) {
+	h := NewHub(nil)
+	h.SetIdentityRateLimit(RateLimit{PerSecond: 0.001, Burst: 2})
+	a := h.newLimiter("bob@example.com")
+	b := h.newLimiter("bob@example.com")
+	if !a.allow() || !b.allow() {
+		t.Fatal("burst should be allowed")
+	}
+	if a.allow() || b.allow() {
+		t.Fatal("identity limit not shared between connections")
+	}
+	a.stop()
+	b.stop()
+	// The bucket outlives the connections until it refills, so reconnecting
+	// doesn't reset the limit.
+	if c := h.newLimiter("bob@example.com"); c.allow() {
+		t.Fatal("reconnecting reset the identity limit")
+	}
+	if anon := h.newLimiter(""); anon.identity != nil {
+		t.Fatal("anonymous clients have no identity bucket")
+	}
+}
+
+func TestRateLimitedClientDisconnected(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.SetClientRateLimit(RateLimit{PerSecond: 0.001, Burst: 2})
+	conn := dial(t, h)
+
+	for i := 0; i < 3; i++ {
+		conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "room"})
+	}
+	// Confirmations of the allowed subscriptions come from the hub and may
+	// arrive on either side of the error, or not at all once the client is
+	// gone.
+	limited := false
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var e Envelope
+		err := conn.ReadJSON(&e)
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+				t.Fatalf("expected connection closed, got %v", err)
+			}
+			break
+		}
+		switch {
+		case e.Type == TypeError && e.Error == errRateLimited.Error():
+			limited = true
+		case e.Type != TypeSubscribed:
+			t.Fatalf("unexpected frame %#v", e)
+		}
+	}
+	if !limited {
+		t.Fatal("no rate limit error before the connection closed")
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.SetReadLimit(64)
+	conn := dial(t, h)
+
+	conn.WriteJSON(map[string]string{"command": "message", "identifier": "room", "data": strings.Repeat("x", 100)})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("expected close 1009, got %v", err)
+	}
+}
+
+func TestOriginChecked(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	HUB = h
+	srv := httptest.NewServer(http.HandlerFunc(ServeWs))
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	header := http.Header{"Origin": {"https://attacker.test"}}
+	if _, resp, err := websocket.DefaultDialer.Dial(url, header); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected cross-origin upgrade to be refused, got %v", err)
+	}
+
+	header = http.Header{"Origin": {srv.URL}}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("same-origin upgrade refused: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+var errClosed = errors.New("connection closed")
+
+// LocalConn is a connection to a hub made from inside the process, with no
+// WebSocket in between. It speaks the client protocol: Send takes the JSON
+// commands a browser would send and Frames delivers the envelopes it would
+// receive. Commands go through the same authorization, rate limits and
+// server-side Channels as WebSocket clients. ws/wstest builds its fake
+// clients on it.
+type LocalConn struct {
+	client *Client
+	// mu serializes commands, which a WebSocket client reads one at a time.
+	mu   sync.Mutex
+	once sync.Once
+}
+
+// ConnectLocal opens a local connection acting as identity, or as an
+// anonymous client if identity is "". r stands in for the upgrade request
+// passed to authorizers, Channels and calls; nil means a bare GET /ws.
+func (h *Hub) ConnectLocal(r *http.Request, identity string) (*LocalConn, error) {
+	if r == nil {
+		var err error
+		if r, err = http.NewRequest(http.MethodGet, "/ws", nil); err != nil {
+			return nil, err
+		}
+	}
+	c := &Client{
+		hub:           h,
+		send:          make(chan Frame, 256),
+		subscriptions: make(map[string]bool),
+		request:       r,
+		identity:      identity,
+	}
+	// Local connections have no goroutines of their own for Shutdown to
+	// wait for; closing send is all it takes to end them.
+	if !h.track(c, 0) {
+		return nil, errShuttingDown
+	}
+	c.start()
+	return &LocalConn{client: c}, nil
+}
+
+// Send runs one command as if the client had sent it over its WebSocket. It
+// fails if the connection is already closed. A command that gets the client
+// disconnected, by exceeding a rate limit, closes the connection like it
+// would a WebSocket: Frames delivers the error frame and is then closed.
+func (lc *LocalConn) Send(command []byte) error {
+	return lc.run(command, false)
+}
+
+// SendBinary is Send for a binary frame: a JSON command, a newline and the
+// raw data.
+func (lc *LocalConn) SendBinary(message []byte) error {
+	return lc.run(message, true)
+}
+
+func (lc *LocalConn) run(message []byte, binary bool) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.client.isClosed() {
+		return errClosed
+	}
+	if !lc.client.handle(message, binary) {
+		lc.close()
+	}
+	return nil
+}
+
+// Frames returns the channel the connection's frames are delivered on. It is
+// closed, after the frames still queued, when the connection closes.
+func (lc *LocalConn) Frames() <-chan Frame {
+	return lc.client.send
+}
+
+// Close disconnects, like a browser closing its WebSocket. Calling it more
+// than once is safe.
+func (lc *LocalConn) Close() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.close()
+}
+
+func (lc *LocalConn) close() {
+	lc.once.Do(lc.client.stop)
+}
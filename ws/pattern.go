@@ -0,0 +1,204 @@
+package ws
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Channel names are made of segments separated by ":", e.g. "orders:42" or
+// "tenant:42:invoices". A subscription may use "*" segments as wildcards:
+//
+//   - a "*" in the middle matches exactly one segment: "tenant:*:invoices"
+//     matches "tenant:42:invoices";
+//   - a trailing "*" matches one or more segments: "orders:*" matches
+//     "orders:42" and "orders:42:items", and "*" on its own matches every
+//     channel.
+
+// patternsOverlap reports whether some channel matches both a and b. Either
+// may be a subscription pattern or a Channel pattern, whose "{param}"
+// segments match one segment like a middle "*".
+func patternsOverlap(a, b string) bool {
+	as, bs := strings.Split(a, ":"), strings.Split(b, ":")
+	for i := 0; ; i++ {
+		switch {
+		case i == len(as) || i == len(bs):
+			return len(as) == len(bs)
+		case (as[i] == "*" && i == len(as)-1) || (bs[i] == "*" && i == len(bs)-1):
+			// The other side has at least this segment left to match.
+			return true
+		case !anySegment(as[i]) && !anySegment(bs[i]) && as[i] != bs[i]:
+			return false
+		}
+	}
+}
+
+// anySegment reports whether a pattern segment matches any single segment.
+func anySegment(seg string) bool {
+	return seg == "*" || (strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"))
+}
+
+// isPattern reports whether a subscription name contains wildcards.
+func isPattern(name string) bool {
+	for _, seg := range strings.Split(name, ":") {
+		if seg == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// patternIndex is a trie of wildcard subscriptions keyed by segment. Matching
+// a channel only walks the branches that can match it, so the cost of a
+// broadcast doesn't grow with the number of unrelated patterns.
+type patternIndex[T comparable] struct {
+	root patternNode[T]
+}
+
+type patternNode[T comparable] struct {
+	children map[string]*patternNode[T]
+	// exact holds members whose pattern ends at this node.
+	exact map[T]bool
+	// tail holds members whose pattern ends with a trailing "*" right after
+	// this node.
+	tail map[T]bool
+}
+
+// add subscribes m to pattern.
+func (ix *patternIndex[T]) add(pattern string, m T) {
+	segs := strings.Split(pattern, ":")
+	n := &ix.root
+	last := len(segs) - 1
+	for i, seg := range segs {
+		if i == last && seg == "*" {
+			if n.tail == nil {
+				n.tail = make(map[T]bool)
+			}
+			n.tail[m] = true
+			return
+		}
+		if n.children == nil {
+			n.children = make(map[string]*patternNode[T])
+		}
+		child, ok := n.children[seg]
+		if !ok {
+			child = &patternNode[T]{}
+			n.children[seg] = child
+		}
+		n = child
+	}
+	if n.exact == nil {
+		n.exact = make(map[T]bool)
+	}
+	n.exact[m] = true
+}
+
+// remove unsubscribes m from pattern, pruning nodes that become empty.
+func (ix *patternIndex[T]) remove(pattern string, m T) {
+	ix.root.remove(strings.Split(pattern, ":"), m)
+}
+
+func (n *patternNode[T]) remove(segs []string, m T) {
+	switch {
+	case len(segs) == 1 && segs[0] == "*":
+		delete(n.tail, m)
+		return
+	case len(segs) == 0:
+		delete(n.exact, m)
+		return
+	}
+	child, ok := n.children[segs[0]]
+	if !ok {
+		return
+	}
+	child.remove(segs[1:], m)
+	if child.empty() {
+		delete(n.children, segs[0])
+	}
+}
+
+func (n *patternNode[T]) empty() bool {
+	return len(n.children) == 0 && len(n.exact) == 0 && len(n.tail) == 0
+}
+
+// match calls fn for every member with a pattern matching channel. A member
+// subscribed through several matching patterns is reported once per pattern.
+func (ix *patternIndex[T]) match(channel string, fn func(T)) {
+	ix.root.match(strings.Split(channel, ":"), fn)
+}
+
+func (n *patternNode[T]) match(segs []string, fn func(T)) {
+	if len(segs) == 0 {
+		for m := range n.exact {
+			fn(m)
+		}
+		return
+	}
+	for m := range n.tail {
+		fn(m)
+	}
+	if child, ok := n.children[segs[0]]; ok {
+		child.match(segs[1:], fn)
+	}
+	if child, ok := n.children["*"]; ok {
+		child.match(segs[1:], fn)
+	}
+}
+
+// listener is a server-side subscription created with Hub.Subscribe.
+type listener struct {
+	fn    func(channel string, data []byte)
+	queue chan BroadcastMessage
+	done  chan struct{}
+}
+
+// Subscribe calls fn for every message broadcast on a channel matching
+// pattern, which may be an exact channel name or use wildcards ("orders:*").
+// fn runs on a goroutine of its own, one message at a time and in broadcast
+// order; messages are dropped if it falls more than 256 behind. The returned
+// function cancels the subscription.
+func (h *Hub) Subscribe(pattern string, fn func(channel string, data []byte)) (cancel func()) {
+	l := &listener{
+		fn:    fn,
+		queue: make(chan BroadcastMessage, 256),
+		done:  make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.listeners.add(pattern, l)
+	h.mu.Unlock()
+	go func() {
+		for {
+			select {
+			case msg := <-l.queue:
+				l.fn(msg.channel, msg.data)
+			case <-l.done:
+				return
+			}
+		}
+	}()
+
+	cancelled := false
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if cancelled {
+			return
+		}
+		cancelled = true
+		h.listeners.remove(pattern, l)
+		close(l.done)
+	}
+}
+
+// notifyListeners hands msg to the server-side subscriptions matching its
+// channel. It runs on the hub goroutine and never blocks.
+func (h *Hub) notifyListeners(msg BroadcastMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.listeners.match(msg.channel, func(l *listener) {
+		select {
+		case l.queue <- msg:
+		default:
+			slog.Warn("server-side subscriber falling behind, message dropped", "channel", msg.channel)
+		}
+	})
+}
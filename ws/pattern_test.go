@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPatternIndexMatch(t *testing.T) {
+	var ix patternIndex[string]
+	for _, p := range []string{"orders:*", "tenant:*:invoices", "tenant:42:*", "*", "news"} {
+		ix.add(p, p)
+	}
+	cases := map[string][]string{
+		"orders:1":           {"*", "orders:*"},
+		"orders:1:items":     {"*", "orders:*"},
+		"orders":             {"*"},
+		"tenant:42:invoices": {"*", "tenant:*:invoices", "tenant:42:*"},
+		"tenant:7:invoices":  {"*", "tenant:*:invoices"},
+		"news":               {"*", "news"},
+	}
+	for channel, want := range cases {
+		var got []string
+		ix.match(channel, func(p string) { got = append(got, p) })
+		sort.Strings(got)
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %v, got %v", channel, want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: expected %v, got %v", channel, want, got)
+			}
+		}
+	}
+
+	ix.remove("tenant:*:invoices", "tenant:*:invoices")
+	ix.remove("*", "*")
+	var got []string
+	ix.match("tenant:7:invoices", func(p string) { got = append(got, p) })
+	if len(got) != 0 {
+		t.Fatalf("expected no matches after remove, got %v", got)
+	}
+	if _, ok := ix.root.children["tenant"].children["*"]; ok {
+		t.Fatalf("empty branch not pruned")
+	}
+}
+
+func TestWildcardSubscription(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: c, channel: "orders:*"}
+	h.register <- Subscription{client: c, channel: "orders:1"}
+	time.Sleep(10 * time.Millisecond)
+
+	h.Broadcast("orders:1", []byte("paid"))
+	h.Broadcast("invoices:1", []byte("ignored"))
+	time.Sleep(20 * time.Millisecond)
+
+	if len(c.send) != 1 {
+		t.Fatalf("expected exactly one frame, got %d", len(c.send))
+	}
+	var e Envelope
+	json.Unmarshal((<-c.send).Data, &e)
+	if e.Channel != "orders:1" || string(e.Payload) != `"paid"` {
+		t.Fatalf("unexpected envelope %#v", e)
+	}
+
+	h.unregister <- Subscription{client: c, channel: "orders:*"}
+	h.unregister <- Subscription{client: c, channel: "orders:1"}
+	time.Sleep(10 * time.Millisecond)
+	h.Broadcast("orders:2", []byte("shipped"))
+	time.Sleep(20 * time.Millisecond)
+	if len(c.send) != 0 {
+		t.Fatalf("unsubscribed pattern still delivered")
+	}
+}
+
+func TestServerSideSubscribe(t *testing.T) {
+	h := NewHub(nil)
+	go h.Run()
+	got := make(chan string, 10)
+	cancel := h.Subscribe("tenant:42:*", func(channel string, data []byte) {
+		got <- channel + "=" + string(data)
+	})
+
+	h.Broadcast("tenant:42:orders", []byte("a"))
+	h.Broadcast("tenant:7:orders", []byte("b"))
+	select {
+	case m := <-got:
+		if m != "tenant:42:orders=a" {
+			t.Fatalf("unexpected message %q", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("listener not called")
+	}
+
+	cancel()
+	cancel()
+	h.Broadcast("tenant:42:orders", []byte("c"))
+	time.Sleep(20 * time.Millisecond)
+	if len(got) != 0 {
+		t.Fatalf("cancelled listener still called")
+	}
+}
+
+func TestPatternsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"chat:*", "chat:{room}", true},
+		{"*", "chat:{room}", true},
+		{"*:lobby", "chat:{room}", true},
+		{"chat:*:typing", "chat:{room}", false},
+		{"news:*", "chat:{room}", false},
+		{"chat:*", "chat", false},
+		{"chat:*", "chat:*", true},
+		{"tenant:*:invoices", "tenant:{id}:*", true},
+	}
+	for _, tt := range tests {
+		if got := patternsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("patternsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Presence event types sent to the members of a channel.
+const (
+	TypeJoin  = "join"
+	TypeLeave = "leave"
+)
+
+// defaultPresenceGrace is how long an identity may be gone from a channel
+// before a leave event is sent. Reconnecting within the grace period (a page
+// reload, a flaky network) produces neither a leave nor a new join.
+const defaultPresenceGrace = 5 * time.Second
+
+// presenceKey identifies one identity in one channel.
+type presenceKey struct {
+	channel  string
+	identity string
+}
+
+// presence tracks who is in each channel. It is owned by the hub goroutine;
+// Hub.Presence reads it under the hub lock.
+type presence struct {
+	// counts holds how many connections each identity has in a channel, so a
+	// user with several tabs open only leaves when the last one does.
+	counts map[presenceKey]int
+	// identities remembers which identity each client subscribed as.
+	identities map[*Client]map[string]string
+	// leaving holds the pending leave timers of identities in their grace
+	// period.
+	leaving map[presenceKey]*time.Timer
+	expired chan presenceKey
+	grace   time.Duration
+}
+
+func newPresence() *presence {
+	return &presence{
+		counts:     make(map[presenceKey]int),
+		identities: make(map[*Client]map[string]string),
+		leaving:    make(map[presenceKey]*time.Timer),
+		expired:    make(chan presenceKey, 256),
+		grace:      defaultPresenceGrace,
+	}
+}
+
+// GuestPrefix starts every identity an anonymous client names itself with,
+// so a guest calling itself "alice@example.com" is listed as
+// "guest:alice@example.com" and can't pass for the logged in user.
+const GuestPrefix = "guest:"
+
+// Presence returns the identities currently present in channel, sorted.
+// Identities inside their reconnect grace period are still listed.
+func (h *Hub) Presence(channel string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var ids []string
+	for key := range h.presence.counts {
+		if key.channel == channel {
+			ids = append(ids, key.identity)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// join records that client entered channel as identity and announces the
+// identity unless it is already present or reconnecting within its grace
+// period. It runs on the hub goroutine.
+func (h *Hub) join(channel string, client *Client, identity string) {
+	if identity == "" {
+		return
+	}
+	key := presenceKey{channel, identity}
+	h.mu.Lock()
+	if h.presence.identities[client] == nil {
+		h.presence.identities[client] = make(map[string]string)
+	}
+	if _, ok := h.presence.identities[client][channel]; ok {
+		h.mu.Unlock()
+		return
+	}
+	h.presence.identities[client][channel] = identity
+	h.presence.counts[key]++
+	first := h.presence.counts[key] == 1
+	timer, reconnecting := h.presence.leaving[key]
+	if reconnecting {
+		timer.Stop()
+		delete(h.presence.leaving, key)
+	}
+	h.mu.Unlock()
+
+	if first && !reconnecting {
+		h.announce(TypeJoin, key)
+	}
+}
+
+// leave records that client left channel. When the identity's last
+// connection goes, the leave event is delayed by the grace period. It runs on
+// the hub goroutine.
+func (h *Hub) leave(channel string, client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	identity, ok := h.presence.identities[client][channel]
+	if !ok {
+		return
+	}
+	delete(h.presence.identities[client], channel)
+	if len(h.presence.identities[client]) == 0 {
+		delete(h.presence.identities, client)
+	}
+	key := presenceKey{channel, identity}
+	h.presence.counts[key]--
+	if h.presence.counts[key] > 0 {
+		return
+	}
+	expired, done := h.presence.expired, h.done
+	h.presence.leaving[key] = time.AfterFunc(h.presence.grace, func() {
+		select {
+		case expired <- key:
+		case <-done:
+		}
+	})
+}
+
+// expire completes a delayed leave once its grace period is over. It runs on
+// the hub goroutine.
+func (h *Hub) expire(key presenceKey) {
+	h.mu.Lock()
+	if _, pending := h.presence.leaving[key]; !pending || h.presence.counts[key] > 0 {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.presence.leaving, key)
+	delete(h.presence.counts, key)
+	h.mu.Unlock()
+	h.announce(TypeLeave, key)
+}
+
+// announce sends a presence event to every client in the channel.
+func (h *Hub) announce(typ string, key presenceKey) {
+	body, _ := json.Marshal(map[string]string{"identity": key.identity})
+	env := Envelope{Type: typ, Channel: key.channel, Payload: body}
+	h.mu.RLock()
+	var targets []*Client
+	for c := range h.channels[key.channel] {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+	for _, c := range targets {
+		c.notify(env)
+	}
+}
@@ -0,0 +1,94 @@
+package ws
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// drain returns the envelopes currently queued for c.
+func drain(t *testing.T, c *Client) []Envelope {
+	t.Helper()
+	var out []Envelope
+	for len(c.send) > 0 {
+		var e Envelope
+		if err := json.Unmarshal((<-c.send).Data, &e); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func TestPresenceJoinAndLeave(t *testing.T) {
+	h := NewHub(setupDB(t))
+	h.presence.grace = 20 * time.Millisecond
+	go h.Run()
+
+	watcher := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	alice := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: watcher, channel: "room", identity: "watcher"}
+	h.register <- Subscription{client: alice, channel: "room", identity: "alice"}
+	time.Sleep(10 * time.Millisecond)
+
+	if got := h.Presence("room"); !reflect.DeepEqual(got, []string{"alice", "watcher"}) {
+		t.Fatalf("unexpected presence %v", got)
+	}
+	drain(t, watcher)
+
+	h.unregister <- Subscription{client: alice, channel: "room"}
+	time.Sleep(50 * time.Millisecond)
+
+	events := drain(t, watcher)
+	if len(events) != 1 || events[0].Type != TypeLeave || string(events[0].Payload) != `{"identity":"alice"}` {
+		t.Fatalf("expected leave event, got %#v", events)
+	}
+	if got := h.Presence("room"); !reflect.DeepEqual(got, []string{"watcher"}) {
+		t.Fatalf("unexpected presence after leave %v", got)
+	}
+}
+
+func TestPresenceReconnectWithinGraceDoesNotFlap(t *testing.T) {
+	h := NewHub(setupDB(t))
+	h.presence.grace = 50 * time.Millisecond
+	go h.Run()
+
+	watcher := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: watcher, channel: "room", identity: "watcher"}
+	first := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: first, channel: "room", identity: "alice"}
+	time.Sleep(50 * time.Millisecond)
+	drain(t, watcher)
+
+	// alice reloads the page: the old connection goes, a new one arrives.
+	h.unregister <- Subscription{client: first, channel: "room"}
+	time.Sleep(5 * time.Millisecond)
+	second := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: second, channel: "room", identity: "alice"}
+	time.Sleep(80 * time.Millisecond)
+
+	if events := drain(t, watcher); len(events) != 0 {
+		t.Fatalf("expected no presence events, got %#v", events)
+	}
+	if got := h.Presence("room"); !reflect.DeepEqual(got, []string{"alice", "watcher"}) {
+		t.Fatalf("unexpected presence %v", got)
+	}
+}
+
+func TestGuestIdentitiesArePrefixed(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	conn := dial(t, h)
+
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "room", "identity": "alice@example.com"})
+	if e := readEnvelope(t, conn); e.Type != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %#v", e)
+	}
+	if e := readEnvelope(t, conn); e.Type != TypeJoin || string(e.Payload) != `{"identity":"guest:alice@example.com"}` {
+		t.Fatalf("expected a guest join, got %#v", e)
+	}
+	if got := h.Presence("room"); !reflect.DeepEqual(got, []string{"guest:alice@example.com"}) {
+		t.Fatalf("unexpected presence %v", got)
+	}
+}
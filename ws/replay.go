@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"monolith/app/models"
+
+	"gorm.io/gorm"
+)
+
+// maxReplay caps how many stored messages a single subscribe can replay. It is
+// kept below the client send buffer so a replay never overflows it on its own.
+const maxReplay = 200
+
+// TypeTruncated is sent before a replay that left out messages after the
+// cursor because more matched than the limit. Its payload,
+// {"before": 42}, is the ID of the first replayed message: the client
+// missed messages older than that one and must refetch them some other way.
+const TypeTruncated = "truncated"
+
+// Cursor identifies a position in a channel's message history. Clients send it
+// as the "since" field of a subscribe command, either as a message ID
+// (42 or "42") or as an RFC 3339 timestamp ("2024-01-02T15:04:05Z").
+// Replay starts with the first message after the cursor.
+type Cursor struct {
+	ID   uint
+	Time time.Time
+}
+
+// UnmarshalJSON accepts a message ID (number or numeric string) or an
+// RFC 3339 timestamp.
+func (c *Cursor) UnmarshalJSON(b []byte) error {
+	raw := string(bytes.Trim(b, `"`))
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	if id, err := strconv.ParseUint(raw, 10, 64); err == nil {
+		c.ID = uint(id)
+		return nil
+	}
+	var ts string
+	if err := json.Unmarshal(b, &ts); err != nil {
+		return fmt.Errorf("invalid cursor %s", b)
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return fmt.Errorf("invalid cursor %q: %w", ts, err)
+	}
+	c.Time = t
+	return nil
+}
+
+// history returns the stored messages for channel after the cursor, oldest
+// first. When more than limit messages match, the most recent ones are kept so
+// the replay joins up with live delivery. A nil cursor means "from the start".
+func (h *Hub) history(channel string, since *Cursor, limit int) ([]models.Message, error) {
+	if limit <= 0 || limit > maxReplay {
+		limit = maxReplay
+	}
+	var msgs []models.Message
+	if err := h.historyQuery(channel, since).Order("id desc").Limit(limit).Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	// Reverse into chronological order.
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
+
+// historyQuery selects the stored messages for channel after the cursor.
+func (h *Hub) historyQuery(channel string, since *Cursor) *gorm.DB {
+	// Messages marked inactive are hidden from replays.
+	q := h.db.Where("channel = ? AND is_active = ?", channel, true)
+	if since != nil {
+		if since.ID > 0 {
+			q = q.Where("id > ?", since.ID)
+		} else if !since.Time.IsZero() {
+			q = q.Where("created_at > ?", since.Time.UTC())
+		}
+	}
+	// Expired messages may not have been pruned yet.
+	if ttl := h.retentionFor(channel).TTL; ttl > 0 {
+		q = q.Where("created_at > ?", time.Now().UTC().Add(-ttl))
+	}
+	return q
+}
+
+// truncated reports whether messages after the cursor are older than first,
+// the oldest message history returned, and so were left out of the replay.
+func (h *Hub) truncated(channel string, since *Cursor, first uint) bool {
+	var older []models.Message
+	if err := h.historyQuery(channel, since).Where("id < ?", first).Limit(1).Find(&older).Error; err != nil {
+		slog.Error("replay query failed", "channel", channel, "error", err)
+		return false
+	}
+	return len(older) > 0
+}
+
+// replay sends the stored history requested by a subscription to its client.
+// It must run on the hub goroutine, before the client is added to the channel.
+// Frames that don't fit in the send buffer are handled by the slow consumer
+// policy like any other message. Wildcard subscriptions are not replayed.
+func (h *Hub) replay(sub Subscription) {
+	if h.db == nil || (sub.since == nil && sub.limit <= 0) || isPattern(sub.channel) {
+		return
+	}
+	msgs, err := h.history(sub.channel, sub.since, sub.limit)
+	if err != nil {
+		slog.Error("replay query failed", "channel", sub.channel, "error", err)
+		return
+	}
+	// A client resuming from a cursor expects no gaps, so it is told when
+	// the limit cut the replay short. Asking for the latest messages without
+	// a cursor is not a gap.
+	if sub.since != nil && len(msgs) > 0 && h.truncated(sub.channel, sub.since, msgs[0].ID) {
+		body, _ := json.Marshal(map[string]uint{"before": msgs[0].ID})
+		sub.client.notify(Envelope{Type: TypeTruncated, Channel: sub.channel, Payload: body})
+	}
+	for _, m := range msgs {
+		out := newFrames(storedMessage(m))
+		if !sub.client.queue(out.forClient(sub.client)) {
+			return
+		}
+		if sub.client.replayed == nil {
+			sub.client.replayed = make(map[string]uint)
+		}
+		sub.client.replayed[sub.channel] = m.ID
+	}
+}
@@ -0,0 +1,154 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"monolith/app/models"
+)
+
+func TestCursorUnmarshal(t *testing.T) {
+	var c Cursor
+	if err := json.Unmarshal([]byte(`42`), &c); err != nil || c.ID != 42 {
+		t.Fatalf("numeric cursor: %v %#v", err, c)
+	}
+	c = Cursor{}
+	if err := json.Unmarshal([]byte(`"7"`), &c); err != nil || c.ID != 7 {
+		t.Fatalf("string id cursor: %v %#v", err, c)
+	}
+	c = Cursor{}
+	if err := json.Unmarshal([]byte(`"2024-01-02T15:04:05Z"`), &c); err != nil || c.Time.Year() != 2024 {
+		t.Fatalf("timestamp cursor: %v %#v", err, c)
+	}
+	if err := json.Unmarshal([]byte(`"yesterday"`), &c); err == nil {
+		t.Fatalf("expected error for invalid cursor")
+	}
+}
+
+func TestSubscribeReplaysSinceID(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	go h.Run()
+	for _, m := range []string{"one", "two", "three"} {
+		h.Broadcast("room", []byte(m))
+	}
+	h.Broadcast("other", []byte("nope"))
+	time.Sleep(20 * time.Millisecond)
+
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool), legacy: true}
+	h.register <- Subscription{client: c, channel: "room", since: &Cursor{ID: 1}}
+	time.Sleep(20 * time.Millisecond)
+	h.Broadcast("room", []byte("four"))
+	time.Sleep(20 * time.Millisecond)
+
+	want := []string{"two", "three", "four"}
+	for _, w := range want {
+		select {
+		case got := <-c.send:
+			if string(got.Data) != w {
+				t.Fatalf("expected %q, got %q", w, got.Data)
+			}
+		default:
+			t.Fatalf("missing %q", w)
+		}
+	}
+	if len(c.send) != 0 {
+		t.Fatalf("unexpected extra messages")
+	}
+}
+
+func TestSubscribeReplayLimitKeepsNewest(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	go h.Run()
+	for _, m := range []string{"a", "b", "c", "d"} {
+		h.Broadcast("room", []byte(m))
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool), legacy: true}
+	h.register <- Subscription{client: c, channel: "room", limit: 2}
+	time.Sleep(20 * time.Millisecond)
+
+	if got := string((<-c.send).Data); got != "c" {
+		t.Fatalf("expected c, got %q", got)
+	}
+	if got := string((<-c.send).Data); got != "d" {
+		t.Fatalf("expected d, got %q", got)
+	}
+}
+
+func TestHistorySinceTimeInAnyZone(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	base := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	for i, content := range []string{"early", "late"} {
+		m := models.Message{Channel: "room", Content: content, CreatedAt: base.Add(time.Duration(i) * time.Hour)}
+		if err := db.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 20:30 at +05:00 is 15:30 UTC, between the two messages.
+	since := &Cursor{Time: base.Add(30 * time.Minute).In(time.FixedZone("", 5*60*60))}
+	msgs, err := h.history("room", since, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Content != "late" {
+		t.Fatalf("expected only the late message, got %#v", msgs)
+	}
+}
+
+func TestHistorySkipsInactiveMessages(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	for _, m := range []models.Message{
+		{Channel: "room", Content: "shown", IsActive: true},
+		{Channel: "room", Content: "hidden", IsActive: true},
+	} {
+		if err := db.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&models.Message{}).Where("content = ?", "hidden").Update("is_active", false)
+
+	msgs, err := h.history("room", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Content != "shown" {
+		t.Fatalf("expected only the active message, got %#v", msgs)
+	}
+}
+
+func TestTruncatedReplayIsMarked(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	for _, m := range []string{"a", "b", "c", "d", "e"} {
+		h.Broadcast("room", []byte(m))
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: c, channel: "room", since: &Cursor{ID: 1}, limit: 2}
+	time.Sleep(20 * time.Millisecond)
+	events := drain(t, c)
+	if len(events) != 3 || events[0].Type != TypeTruncated || string(events[0].Payload) != `{"before":4}` {
+		t.Fatalf("expected a truncation marker before the replay, got %#v", events)
+	}
+	if events[1].ID != 4 || events[2].ID != 5 {
+		t.Fatalf("expected the newest messages, got %#v", events[1:])
+	}
+
+	// Nothing was left out.
+	h.register <- Subscription{client: c, channel: "other", since: &Cursor{ID: 3}, limit: 2}
+	h.register <- Subscription{client: c, channel: "room", since: &Cursor{ID: 3}, limit: 2}
+	time.Sleep(20 * time.Millisecond)
+	for _, e := range drain(t, c) {
+		if e.Type == TypeTruncated {
+			t.Fatalf("unexpected truncation marker %#v", e)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package ws
+
+import (
+	"log/slog"
+	"time"
+
+	"monolith/app/models"
+)
+
+// Retention says whether and for how long the messages of a channel are kept
+// in the messages table. The zero value keeps them forever, which is the
+// default for channels without a policy.
+type Retention struct {
+	// Ephemeral messages are delivered to current subscribers but never
+	// stored, so they can't be replayed and don't reach other processes
+	// through the backplane. Use it for cursor moves, typing indicators and
+	// other high-frequency events that are stale a moment later.
+	Ephemeral bool
+	// TTL drops stored messages older than this. Zero keeps them regardless
+	// of age.
+	TTL time.Duration
+	// MaxMessages keeps only the newest messages of each channel. Zero keeps
+	// them all.
+	MaxMessages int
+}
+
+// Ephemeral is the Retention of channels whose messages are never stored.
+var Ephemeral = Retention{Ephemeral: true}
+
+// DefaultPruneInterval is how often the pruner enforces TTL and MaxMessages.
+const DefaultPruneInterval = time.Minute
+
+// persistBatch caps how many queued broadcasts are stored in one insert.
+const persistBatch = 100
+
+type retentionPolicy struct {
+	pattern   string
+	retention Retention
+}
+
+// SetRetention applies r to the channels matching pattern, which is an exact
+// channel name or uses the syntax of Rule patterns ("typing:*",
+// "room:{id}:cursor"). Exact names win over patterns; otherwise the first
+// matching policy applies. Call it during startup, before serving requests.
+//
+//	ws.HUB.SetRetention("typing:*", ws.Ephemeral)
+//	ws.HUB.SetRetention("chat:*", ws.Retention{TTL: 7 * 24 * time.Hour, MaxMessages: 1000})
+func (h *Hub) SetRetention(pattern string, r Retention) {
+	h.retention = append(h.retention, retentionPolicy{pattern: pattern, retention: r})
+}
+
+// retentionFor returns the policy that applies to channel.
+func (h *Hub) retentionFor(channel string) Retention {
+	for _, p := range h.retention {
+		if p.pattern == channel {
+			return p.retention
+		}
+	}
+	for _, p := range h.retention {
+		if _, ok := matchPattern(p.pattern, channel); ok {
+			return p.retention
+		}
+	}
+	return Retention{}
+}
+
+// persist stores a batch of broadcast messages in one insert and records the
+// assigned IDs and timestamps on them. Messages on ephemeral channels are
+// never stored and are left without an ID.
+func (h *Hub) persist(batch []BroadcastMessage) {
+	now := time.Now().UTC()
+	var records []models.Message
+	var stored []int
+	for i := range batch {
+		msg := &batch[i]
+		msg.createdAt = now
+		if h.db == nil || h.retentionFor(msg.channel).Ephemeral {
+			continue
+		}
+		records = append(records, msg.record(h.origin))
+		stored = append(stored, i)
+	}
+	if len(records) == 0 {
+		return
+	}
+	if err := h.db.Create(&records).Error; err != nil {
+		slog.Error("DB error", "error", err)
+		return
+	}
+	for j, i := range stored {
+		batch[i].id = records[j].ID
+	}
+}
+
+// StartPruner deletes stored messages that have outlived their channel's TTL
+// or MaxMessages every interval. It does nothing without a database.
+func (h *Hub) StartPruner(interval time.Duration) {
+	if h.db == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultPruneInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.prune()
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+// prune applies the retention policies once. Channels are looked up from the
+// stored messages so that patterns are matched the same way as everywhere
+// else. Retention is a hard limit: expired messages are deleted whether or not
+// they are active, and inactive ones count towards MaxMessages.
+func (h *Hub) prune() {
+	if len(h.retention) == 0 {
+		return
+	}
+	var channels []string
+	if err := h.db.Model(&models.Message{}).Distinct().Pluck("channel", &channels).Error; err != nil {
+		slog.Error("websocket prune failed", "error", err)
+		return
+	}
+	for _, channel := range channels {
+		r := h.retentionFor(channel)
+		q := h.db.Where("channel = ?", channel)
+		switch {
+		case r.Ephemeral:
+			// Stored before the channel became ephemeral; drop them all.
+		case r.TTL > 0 && r.MaxMessages > 0:
+			q = q.Where("created_at < ? OR id < (?)", time.Now().UTC().Add(-r.TTL), h.nthNewest(channel, r.MaxMessages))
+		case r.TTL > 0:
+			q = q.Where("created_at < ?", time.Now().UTC().Add(-r.TTL))
+		case r.MaxMessages > 0:
+			q = q.Where("id < (?)", h.nthNewest(channel, r.MaxMessages))
+		default:
+			continue
+		}
+		res := q.Delete(&models.Message{})
+		if res.Error != nil {
+			slog.Error("websocket prune failed", "channel", channel, "error", res.Error)
+			continue
+		}
+		if res.RowsAffected > 0 {
+			slog.Debug("pruned websocket messages", "channel", channel, "count", res.RowsAffected)
+		}
+	}
+}
+
+// nthNewest is a subquery for the ID of the nth newest message on channel.
+// It is NULL when the channel has fewer messages, so "id < (nthNewest)"
+// matches nothing.
+func (h *Hub) nthNewest(channel string, n int) interface{} {
+	return h.db.Model(&models.Message{}).Select("id").
+		Where("channel = ?", channel).Order("id desc").Offset(n - 1).Limit(1)
+}
@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"monolith/app/models"
+)
+
+func TestRetentionFor(t *testing.T) {
+	h := NewHub(nil)
+	h.SetRetention("typing:*", Ephemeral)
+	h.SetRetention("chat:{room}", Retention{MaxMessages: 10})
+	h.SetRetention("chat:lobby", Retention{TTL: time.Hour})
+
+	if r := h.retentionFor("typing:lobby"); !r.Ephemeral {
+		t.Fatalf("typing should be ephemeral, got %+v", r)
+	}
+	if r := h.retentionFor("chat:team"); r.MaxMessages != 10 {
+		t.Fatalf("chat:team should keep 10 messages, got %+v", r)
+	}
+	if r := h.retentionFor("chat:lobby"); r.TTL != time.Hour {
+		t.Fatalf("exact policy should win, got %+v", r)
+	}
+	if r := h.retentionFor("news"); r != (Retention{}) {
+		t.Fatalf("channels without a policy keep everything, got %+v", r)
+	}
+}
+
+func TestPersistBatch(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	h.SetRetention("typing", Ephemeral)
+
+	batch := []BroadcastMessage{
+		{channel: "chat", data: []byte("one")},
+		{channel: "typing", data: []byte("bob")},
+		{channel: "chat", data: []byte("two")},
+	}
+	h.persist(batch)
+
+	if batch[0].id == 0 || batch[2].id <= batch[0].id {
+		t.Fatalf("expected increasing IDs, got %d and %d", batch[0].id, batch[2].id)
+	}
+	if batch[1].id != 0 || batch[1].createdAt.IsZero() {
+		t.Fatalf("ephemeral message should be timestamped but not stored: %+v", batch[1])
+	}
+	var count int64
+	db.Model(&models.Message{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 stored messages, got %d", count)
+	}
+}
+
+func TestEphemeralChannelDelivered(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	h.SetRetention("typing:*", Ephemeral)
+	go h.Run()
+	conn := dial(t, h)
+
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "typing:lobby"})
+	if e := readEnvelope(t, conn); e.Type != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %#v", e)
+	}
+	time.Sleep(50 * time.Millisecond)
+	h.Broadcast("typing:lobby", []byte("bob"))
+	e := readEnvelope(t, conn)
+	if e.Type != TypeMessage || e.ID != 0 || string(e.Payload) != `"bob"` {
+		t.Fatalf("expected unstored message, got %#v", e)
+	}
+	var count int64
+	db.Model(&models.Message{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("ephemeral message stored")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	h.SetRetention("old", Retention{TTL: time.Hour})
+	h.SetRetention("capped", Retention{MaxMessages: 2})
+	h.SetRetention("gone", Ephemeral)
+	h.SetRetention("both", Retention{TTL: time.Hour, MaxMessages: 2})
+
+	now := time.Now().UTC()
+	for _, m := range []models.Message{
+		{Channel: "old", Content: "stale", CreatedAt: now.Add(-2 * time.Hour)},
+		{Channel: "old", Content: "fresh", CreatedAt: now},
+		{Channel: "capped", Content: "1", CreatedAt: now},
+		{Channel: "capped", Content: "2", CreatedAt: now},
+		{Channel: "capped", Content: "3", CreatedAt: now},
+		{Channel: "gone", Content: "x", CreatedAt: now},
+		{Channel: "kept", Content: "forever", CreatedAt: now.Add(-48 * time.Hour)},
+		{Channel: "both", Content: "expired", CreatedAt: now.Add(-2 * time.Hour)},
+		{Channel: "both", Content: "a", CreatedAt: now},
+		{Channel: "both", Content: "b", CreatedAt: now},
+		{Channel: "both", Content: "c", CreatedAt: now},
+	} {
+		db.Create(&m)
+	}
+
+	h.prune()
+
+	var contents []string
+	db.Model(&models.Message{}).Order("id").Pluck("content", &contents)
+	want := []string{"fresh", "2", "3", "forever", "b", "c"}
+	if len(contents) != len(want) {
+		t.Fatalf("expected %v after pruning, got %v", want, contents)
+	}
+	for i := range want {
+		if contents[i] != want[i] {
+			t.Fatalf("expected %v after pruning, got %v", want, contents)
+		}
+	}
+}
+
+func TestStoredMessagesAreActive(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	go h.Run()
+	h.Broadcast("room", []byte("hi"))
+	time.Sleep(20 * time.Millisecond)
+
+	var m models.Message
+	if err := db.First(&m).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsActive {
+		t.Fatalf("stored message is not active: %#v", m)
+	}
+}
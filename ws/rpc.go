@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// TypeResult is the envelope type of a successful call's reply.
+const TypeResult = "result"
+
+// DefaultCallTimeout bounds how long a call may run when the hub has no
+// timeout of its own configured.
+const DefaultCallTimeout = 10 * time.Second
+
+// maxPendingCalls caps the calls one client may have running at once.
+const maxPendingCalls = 16
+
+var (
+	errUnknownMethod    = errors.New("unknown method")
+	errCallTimeout      = errors.New("timeout")
+	errTooManyCalls     = errors.New("too many pending calls")
+	errMissingReference = errors.New("missing ref")
+)
+
+// Call is a request a client made with the "call" command:
+//
+//	{"command":"call","identifier":"orders.total","ref":"7","data":"{\"id\":42}","timeout":2000}
+//
+// identifier names the method and ref is an ID the client picks to match the
+// reply, which only goes to the calling client:
+//
+//	{"v":1,"type":"result","ref":"7","payload":{"total":1250},"ts":"..."}
+//	{"v":1,"type":"error","command":"call","ref":"7","error":"forbidden","ts":"..."}
+type Call struct {
+	// Method is the name the handler was registered under.
+	Method string
+	// Data is the call's argument, as sent by the client.
+	Data []byte
+	// Identity is the logged in user behind the connection, if any.
+	Identity string
+	// Request is the HTTP request the connection was opened with.
+	Request *http.Request
+}
+
+// CallHandler answers calls to one method. The returned value is sent to the
+// client as JSON (a json.RawMessage is sent as is); a returned error is sent
+// as an error frame. ctx is cancelled when the call times out or the client
+// disconnects. Handlers do their own authorization, e.g. by returning
+// ErrForbidden when call.Identity may not use the method.
+type CallHandler func(ctx context.Context, call *Call) (interface{}, error)
+
+// HandleCall registers fn to answer calls to method. Call it during startup,
+// before serving requests.
+func (h *Hub) HandleCall(method string, fn CallHandler) {
+	if h.methods == nil {
+		h.methods = make(map[string]CallHandler)
+	}
+	h.methods[method] = fn
+}
+
+// SetCallTimeout sets the longest a call may run. Clients may ask for a
+// shorter timeout per call but not a longer one. Call it during startup,
+// before serving requests.
+func (h *Hub) SetCallTimeout(d time.Duration) {
+	h.callTimeout = d
+}
+
+// call runs a client's call on its own goroutine and sends the reply when it
+// finishes or times out, whichever comes first.
+func (c *Client) call(method, ref string, data []byte, timeout time.Duration) {
+	if ref == "" {
+		c.sendError("call", method, errMissingReference)
+		return
+	}
+	fn, ok := c.hub.methods[method]
+	if !ok {
+		c.callError(ref, errUnknownMethod)
+		return
+	}
+	if atomic.AddInt32(&c.pending, 1) > maxPendingCalls {
+		atomic.AddInt32(&c.pending, -1)
+		c.callError(ref, errTooManyCalls)
+		return
+	}
+
+	limit := c.hub.callTimeout
+	if limit <= 0 {
+		limit = DefaultCallTimeout
+	}
+	if timeout <= 0 || timeout > limit {
+		timeout = limit
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	call := &Call{Method: method, Data: data, Identity: c.identity, Request: c.request}
+
+	type reply struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan reply, 1)
+	go func() {
+		// A handler that overruns its timeout still counts as pending until
+		// it returns.
+		defer atomic.AddInt32(&c.pending, -1)
+		result, err := fn(ctx, call)
+		done <- reply{result, err}
+	}()
+	go func() {
+		defer cancel()
+		select {
+		case r := <-done:
+			if r.err != nil {
+				c.callError(ref, r.err)
+				return
+			}
+			result, err := json.Marshal(r.result)
+			if err != nil {
+				slog.Error("encode call result", "method", method, "error", err)
+				c.callError(ref, err)
+				return
+			}
+			c.notify(Envelope{Type: TypeResult, Ref: ref, Payload: result})
+		case <-ctx.Done():
+			// The handler keeps running until it notices ctx; its result is
+			// discarded.
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				slog.Warn("websocket call timed out", "method", method, "timeout", timeout)
+				c.callError(ref, errCallTimeout)
+			}
+		}
+	}()
+}
+
+// callError tells the client that the call ref failed.
+func (c *Client) callError(ref string, reason error) {
+	c.notify(Envelope{Type: TypeError, Command: "call", Ref: ref, Error: reason.Error()})
+}
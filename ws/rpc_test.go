@@ -0,0 +1,67 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCall(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.HandleCall("echo", func(ctx context.Context, call *Call) (interface{}, error) {
+		if string(call.Data) == "forbidden" {
+			return nil, ErrForbidden
+		}
+		return map[string]string{"echo": string(call.Data)}, nil
+	})
+	conn := dial(t, h)
+
+	conn.WriteJSON(map[string]string{"command": "call", "identifier": "echo", "ref": "1", "data": "hi"})
+	e := readEnvelope(t, conn)
+	if e.Type != TypeResult || e.Ref != "1" {
+		t.Fatalf("expected result for ref 1, got %#v", e)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(e.Payload, &got); err != nil || got["echo"] != "hi" {
+		t.Fatalf("unexpected payload %s", e.Payload)
+	}
+
+	conn.WriteJSON(map[string]string{"command": "call", "identifier": "echo", "ref": "2", "data": "forbidden"})
+	if e := readEnvelope(t, conn); e.Type != TypeError || e.Ref != "2" || e.Error != "forbidden" {
+		t.Fatalf("expected forbidden error for ref 2, got %#v", e)
+	}
+
+	conn.WriteJSON(map[string]string{"command": "call", "identifier": "missing", "ref": "3"})
+	if e := readEnvelope(t, conn); e.Type != TypeError || e.Ref != "3" || e.Error != errUnknownMethod.Error() {
+		t.Fatalf("expected unknown method for ref 3, got %#v", e)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.SetCallTimeout(time.Second)
+	cancelled := make(chan struct{})
+	h.HandleCall("slow", func(ctx context.Context, call *Call) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return "too late", nil
+	})
+	conn := dial(t, h)
+
+	start := time.Now()
+	conn.WriteJSON(map[string]interface{}{"command": "call", "identifier": "slow", "ref": "a", "timeout": 50})
+	if e := readEnvelope(t, conn); e.Type != TypeError || e.Ref != "a" || e.Error != errCallTimeout.Error() {
+		t.Fatalf("expected timeout for ref a, got %#v", e)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("client timeout not applied, took %v", elapsed)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context not cancelled")
+	}
+}
@@ -0,0 +1,131 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// shutdownReason is sent with the close frame when the hub shuts down. The
+// status is 1001 (going away); clients should reconnect, typically to a new
+// process.
+const shutdownReason = "server shutting down, reconnect"
+
+var errShuttingDown = errors.New("server shutting down")
+
+// track records a new connection served by n goroutines, which call
+// h.pumps.Done as they exit. It reports false once the hub is shutting down,
+// in which case nothing is recorded.
+func (h *Hub) track(c *Client, n int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopping {
+		return false
+	}
+	h.clients[c] = true
+	h.pumps.Add(n)
+	return true
+}
+
+// isStopping reports whether Shutdown has been called.
+func (h *Hub) isStopping() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.stopping
+}
+
+// refuse answers a connection attempt made while the hub shuts down.
+func refuse(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, errShuttingDown.Error(), http.StatusServiceUnavailable)
+}
+
+// Shutdown stops the hub gracefully:
+//
+//  1. New connections are refused with 503 and new subscriptions ignored.
+//  2. Broadcasts already queued are stored and delivered.
+//  3. Every client is sent what is left in its buffer followed by a close
+//     frame with status 1001 (going away), and SSE streams end.
+//  4. Shutdown waits for the connections' goroutines to exit, then stops the
+//     hub loop, the backplane and the pruner.
+//
+// If ctx ends first Shutdown stops waiting, still stops the hub and returns
+// ctx.Err(). Call it before http.Server.Shutdown, which doesn't track
+// WebSocket connections and would wait for SSE streams until it times out.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if h.stopping {
+		h.mu.Unlock()
+		return nil
+	}
+	h.stopping = true
+	h.mu.Unlock()
+	slog.Info("Shutting down pub/sub")
+	defer close(h.done)
+
+	flushed := make(chan struct{})
+	select {
+	case h.quit <- flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain runs on the hub goroutine when Shutdown starts. It delivers the
+// broadcasts still queued and then closes every client.
+func (h *Hub) drain() {
+	var batch []BroadcastMessage
+queued:
+	for {
+		select {
+		case msg := <-h.broadcast:
+			batch = append(batch, msg)
+		default:
+			break queued
+		}
+	}
+	h.persist(batch)
+	for _, msg := range batch {
+		h.deliver(msg)
+	}
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+	for _, c := range clients {
+		c.setCloseReason(websocket.CloseGoingAway, shutdownReason)
+		h.removeClient(c)
+	}
+}
+
+// leaveHub tells the hub loop that c's connection has gone away. It doesn't
+// block once the hub has stopped.
+func (h *Hub) leaveHub(c *Client) {
+	select {
+	case h.disconnect <- c:
+	case <-h.done:
+	}
+}
@@ -0,0 +1,67 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"monolith/app/models"
+)
+
+func TestShutdown(t *testing.T) {
+	db := setupDB(t)
+	h := NewHub(db)
+	go h.Run()
+	conn := dial(t, h)
+
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "news"})
+	if e := readEnvelope(t, conn); e.Type != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %#v", e)
+	}
+
+	// A broadcast made right before shutdown is stored and delivered before
+	// the close frame.
+	h.Broadcast("news", []byte("last words"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- h.Shutdown(ctx) }()
+
+	if e := readEnvelope(t, conn); e.Type != TypeMessage || string(e.Payload) != `"last words"` {
+		t.Fatalf("expected queued broadcast, got %#v", e)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expected close 1001, got %v", err)
+	}
+	if ce := err.(*websocket.CloseError); ce.Text != shutdownReason {
+		t.Fatalf("unexpected close reason %q", ce.Text)
+	}
+	conn.Close()
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	var count int64
+	db.Model(&models.Message{}).Where("channel = ?", "news").Count(&count)
+	if count != 1 {
+		t.Fatalf("queued broadcast not stored")
+	}
+
+	// New connections are refused.
+	srv := httptest.NewServer(http.HandlerFunc(ServeWs))
+	defer srv.Close()
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 after shutdown, got %v", err)
+	}
+	// Broadcasting after shutdown doesn't block.
+	h.Broadcast("news", []byte("too late"))
+}
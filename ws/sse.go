@@ -0,0 +1,150 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseHeartbeat is how often an idle event stream gets a comment line so
+// proxies don't time it out.
+const sseHeartbeat = 30 * time.Second
+
+// ServeSSE is the handler for the /events endpoint. It streams the broadcasts
+// of one or more channels as Server-Sent Events, for consumers that can't use
+// WebSockets or only need one-way updates:
+//
+//	GET /events?channel=news&channel=user:bob@example.com
+//
+// Each event carries the same JSON envelope a WebSocket client receives, with
+// the stored message ID as the event ID. When the browser reconnects it sends
+// Last-Event-ID and the stream resumes from the messages it missed. Channels
+// are checked with the hub's authorizer and run the Subscribed callbacks of
+// server-side Channels just like WebSocket subscriptions.
+func ServeSSE(w http.ResponseWriter, r *http.Request) {
+	HUB.ServeSSE(w, r)
+}
+
+// ServeSSE is ServeSSE for a hub other than HUB.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	channels := r.URL.Query()["channel"]
+	if len(channels) == 0 {
+		http.Error(w, "missing channel", http.StatusBadRequest)
+		return
+	}
+	if h.isStopping() {
+		refuse(w)
+		return
+	}
+
+	client := &Client{
+		hub:           h,
+		send:          make(chan Frame, 256),
+		subscriptions: make(map[string]bool),
+		request:       r,
+		textOnly:      true,
+		identity:      Identify(r),
+	}
+	for _, channel := range channels {
+		if err := h.authorize(client, channel, ActionSubscribe); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	defer client.unsubscribedAll()
+	for _, channel := range channels {
+		if err := client.subscribed(channel); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Browsers send Last-Event-ID on reconnect; lastEventId lets a page
+	// resume a stream it opened itself.
+	var since *Cursor
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	if id, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+		since = &Cursor{ID: uint(id)}
+	}
+
+	if !h.track(client, 1) {
+		refuse(w)
+		return
+	}
+	defer h.pumps.Done()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for _, channel := range channels {
+		h.register <- Subscription{
+			client:   client,
+			channel:  channel,
+			since:    since,
+			identity: client.identity,
+		}
+	}
+	defer h.leaveHub(client)
+
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case frame, ok := <-client.send:
+			if !ok {
+				// The hub evicted us as a slow consumer or is shutting
+				// down.
+				return
+			}
+			if err := writeEvent(w, frame.Data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes one envelope as a Server-Sent Event. The envelope type
+// becomes the event name and message IDs become event IDs so Last-Event-ID
+// resumes from the right place.
+func writeEvent(w http.ResponseWriter, frame []byte) error {
+	var head struct {
+		Type string `json:"type"`
+		ID   uint   `json:"id"`
+	}
+	json.Unmarshal(frame, &head)
+	if head.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", head.ID); err != nil {
+			return err
+		}
+	}
+	if head.Type != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", head.Type); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", frame)
+	return err
+}
@@ -0,0 +1,76 @@
+package ws
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEStreamsBroadcasts(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.Broadcast("news", []byte("old"))
+	h.Broadcast("news", []byte("missed"))
+	time.Sleep(20 * time.Millisecond)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeSSE(w, r)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"?channel=news", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	h.Broadcast("news", []byte("live"))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	var got []string
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case line := <-lines:
+			if strings.HasPrefix(line, "id: ") {
+				got = append(got, line)
+			}
+			if strings.HasPrefix(line, "data: ") && !strings.Contains(line, `"payload":"missed"`) && !strings.Contains(line, `"payload":"live"`) {
+				t.Fatalf("unexpected event %q", line)
+			}
+		case <-timeout:
+			t.Fatalf("timed out, got %v", got)
+		}
+	}
+	if got[0] != "id: 2" || got[1] != "id: 3" {
+		t.Fatalf("unexpected event ids %v", got)
+	}
+}
+
+func TestSSEDeniedChannel(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	h.SetAuthorizer(Rules{{Pattern: "public"}})
+
+	req := httptest.NewRequest("GET", "/events?channel=public&channel=private", nil)
+	w := httptest.NewRecorder()
+	h.ServeSSE(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"monolith/app/views"
+)
+
+// StreamAction says what a live page update does with its target element.
+type StreamAction string
+
+const (
+	// StreamAppend inserts the HTML as the target's last child.
+	StreamAppend StreamAction = "append"
+	// StreamPrepend inserts the HTML as the target's first child.
+	StreamPrepend StreamAction = "prepend"
+	// StreamReplace replaces the target element itself.
+	StreamReplace StreamAction = "replace"
+	// StreamUpdate replaces the target's contents.
+	StreamUpdate StreamAction = "update"
+	// StreamRemove removes the target element. It carries no HTML.
+	StreamRemove StreamAction = "remove"
+)
+
+// Stream is a live page update: an action applied to the DOM element whose
+// id is Target. It is broadcast as the payload of a TypeStream envelope,
+// which static/js/application.js applies on every page subscribed to the
+// channel.
+type Stream struct {
+	Action StreamAction `json:"action"`
+	Target string       `json:"target"`
+	HTML   string       `json:"html,omitempty"`
+}
+
+// BroadcastStream renders block from the template file name (see
+// views.RenderBlock) with data and broadcasts it as a Stream on channel.
+//
+//	// in a controller, after saving m
+//	ws.BroadcastStream("messages", ws.StreamAppend, "messages",
+//		"messages_index.html.tmpl", "message", m)
+//
+// Model hooks can't import ws; they call models.BroadcastStream, which
+// InitPubSub points here.
+func (h *Hub) BroadcastStream(channel string, action StreamAction, target, name, block string, data interface{}) error {
+	s := Stream{Action: action, Target: target}
+	if action != StreamRemove {
+		var buf bytes.Buffer
+		if err := views.RenderBlock(&buf, name, block, data); err != nil {
+			return fmt.Errorf("render stream: %w", err)
+		}
+		s.HTML = buf.String()
+	}
+	return h.BroadcastStreamHTML(channel, s)
+}
+
+// BroadcastStreamHTML broadcasts an already built Stream on channel.
+func (h *Hub) BroadcastStreamHTML(channel string, s Stream) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	select {
+	case h.broadcast <- BroadcastMessage{channel: channel, data: data, json: true, stream: true}:
+	case <-h.done:
+	}
+	return nil
+}
+
+// BroadcastStream is HUB.BroadcastStream. It is a no-op (returning nil) when
+// the hub isn't running, so model hooks can call it from tests and scripts.
+func BroadcastStream(channel string, action StreamAction, target, name, block string, data interface{}) error {
+	if HUB == nil {
+		slog.Debug("stream not sent, pub/sub not initialized", "channel", channel)
+		return nil
+	}
+	return HUB.BroadcastStream(channel, action, target, name, block, data)
+}
+
+// broadcastModelStream is what models.BroadcastStream calls once the hub is
+// running.
+func broadcastModelStream(channel, action, target, name, block string, data interface{}) error {
+	return BroadcastStream(channel, StreamAction(action), target, name, block, data)
+}
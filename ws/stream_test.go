@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"monolith/app/views"
+)
+
+func TestBroadcastStream(t *testing.T) {
+	views.InitTemplates(fstest.MapFS{
+		"app/views/layouts/application.html.tmpl": {Data: []byte(`{{block "body" .}}{{end}}`)},
+		"app/views/messages.html.tmpl": {Data: []byte(
+			`{{define "body"}}<ul id="messages"></ul>{{end}}` +
+				`{{define "message"}}<li id="message_{{.ID}}">{{.Text}}</li>{{end}}`)},
+	})
+	h := NewHub(setupDB(t))
+	go h.Run()
+	c := &Client{hub: h, send: make(chan Frame, 10), subscriptions: make(map[string]bool)}
+	h.register <- Subscription{client: c, channel: "messages"}
+	time.Sleep(10 * time.Millisecond)
+
+	data := map[string]interface{}{"ID": 7, "Text": "<b>hi</b>"}
+	if err := h.BroadcastStream("messages", StreamAppend, "messages", "messages.html.tmpl", "message", data); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	if err := h.BroadcastStream("messages", StreamAppend, "messages", "messages.html.tmpl", "missing", data); err == nil {
+		t.Fatalf("expected error for missing block")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	var e Envelope
+	json.Unmarshal((<-c.send).Data, &e)
+	if e.Type != TypeStream {
+		t.Fatalf("expected a stream envelope, got %q", e.Type)
+	}
+	var got Stream
+	if err := json.Unmarshal(e.Payload, &got); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	want := Stream{Action: StreamAppend, Target: "messages", HTML: `<li id="message_7">&lt;b&gt;hi&lt;/b&gt;</li>`}
+	if got != want {
+		t.Fatalf("unexpected stream %#v", got)
+	}
+
+	// Replays keep the type.
+	stored, err := h.history("messages", nil, 0)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("expected one stored stream, got %v %#v", err, stored)
+	}
+	json.Unmarshal(newFrames(storedMessage(stored[0])).envelope.Data, &e)
+	if e.Type != TypeStream {
+		t.Fatalf("expected the replay to be a stream, got %q", e.Type)
+	}
+
+	// Model hooks broadcast through models.BroadcastStream.
+	HUB = h
+	if err := broadcastModelStream("messages", "remove", "message_7", "", "", nil); err != nil {
+		t.Fatalf("model stream: %v", err)
+	}
+	json.Unmarshal((<-c.send).Data, &e)
+	var removed Stream
+	if err := json.Unmarshal(e.Payload, &removed); err != nil || removed != (Stream{Action: StreamRemove, Target: "message_7"}) {
+		t.Fatalf("unexpected model stream %#v", removed)
+	}
+}
+
+func TestClientsCannotPublishStreams(t *testing.T) {
+	h := NewHub(setupDB(t))
+	go h.Run()
+	conn := dial(t, h)
+
+	conn.WriteJSON(map[string]string{"command": "subscribe", "identifier": "messages"})
+	if e := readEnvelope(t, conn); e.Type != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %#v", e)
+	}
+	for _, data := range []string{
+		`{"action":"append","target":"messages","html":"<img src=x onerror=alert(1)>"}`,
+		`{"stream":{"action":"append","target":"messages","html":"<img src=x onerror=alert(1)>"}}`,
+	} {
+		conn.WriteJSON(map[string]string{"command": "message", "identifier": "messages", "encoding": "json", "data": data})
+		if e := readEnvelope(t, conn); e.Type != TypeMessage {
+			t.Fatalf("expected an ordinary message, got %#v", e)
+		}
+	}
+}
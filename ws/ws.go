@@ -5,9 +5,13 @@ messages stored in the database.
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"log/slog"
+	"monolith/app/config"
+	"monolith/app/middleware"
 	"monolith/app/models"
 	"monolith/db"
 	"net/http"
@@ -20,6 +24,12 @@ import (
 
 var HUB *Hub
 
+var (
+	errInvalidCommand = errors.New("invalid command")
+	errUnknownCommand = errors.New("unknown command")
+	errInvalidJSON    = errors.New("data is not valid JSON")
+)
+
 // Hub manages channels, subscriptions, and broadcasts.
 type Hub struct {
 	// Map from channel name to set of clients subscribed.
@@ -27,45 +37,149 @@ type Hub struct {
 	register   chan Subscription
 	unregister chan Subscription
 	broadcast  chan BroadcastMessage
-	db         *gorm.DB
-	mu         sync.RWMutex
+	// disconnect receives clients whose connection has gone away.
+	disconnect   chan *Client
+	db           *gorm.DB
+	mu           sync.RWMutex
+	authorizer   Authorizer
+	presence     *presence
+	handlers     []channelHandler
+	slowConsumer SlowConsumerPolicy
+	// origin tags the messages this hub stores so the backplane can tell
+	// them apart from those of other processes.
+	origin string
+	// backplaneStart and backplanePoll hand the backplane's work to the hub
+	// loop, which owns remoteLast, the ID of the last remote message seen,
+	// and sets backplane once started.
+	backplaneStart chan uint
+	backplanePoll  chan struct{}
+	backplane      bool
+	remoteLast     uint
+	// patterns indexes client subscriptions that use wildcards and listeners
+	// the server-side subscriptions made with Subscribe. Both are guarded by
+	// mu.
+	patterns  patternIndex[*Client]
+	listeners patternIndex[*listener]
+	// methods holds the call handlers registered with HandleCall.
+	methods     map[string]CallHandler
+	callTimeout time.Duration
+	// retention holds the policies registered with SetRetention.
+	retention []retentionPolicy
+	// readLimit and the rate limits are set with SetReadLimit,
+	// SetClientRateLimit and SetIdentityRateLimit.
+	readLimit       int64
+	clientLimit     RateLimit
+	identityLimit   RateLimit
+	identityBuckets identityBuckets
+	// clients holds every open connection, so Shutdown can close them, and
+	// stopping is set once it has been called. Both are guarded by mu.
+	// pumps counts the goroutines serving connections.
+	clients  map[*Client]bool
+	stopping bool
+	pumps    sync.WaitGroup
+	// quit asks the hub loop to start shutting down and done stops it and
+	// the backplane and pruner.
+	quit chan chan struct{}
+	done chan struct{}
+	// compression is set with SetCompression.
+	compression Compression
 }
 
 // Subscription represents a client's subscription to a channel.
 type Subscription struct {
 	client  *Client
 	channel string
+	// since and limit request a replay of stored messages before live
+	// delivery starts. Both are optional.
+	since *Cursor
+	limit int
+	// ack is set when the client asked for the change and expects a
+	// subscribed/unsubscribed confirmation.
+	ack bool
+	// identity is who the client is in this channel, for presence. Empty for
+	// anonymous clients.
+	identity string
 }
 
 // BroadcastMessage contains a message destined for a channel.
 type BroadcastMessage struct {
 	channel string
 	data    []byte
+	// id and createdAt are filled in once the message is persisted.
+	id        uint
+	createdAt time.Time
+	// binary messages are sent in binary frames, see BroadcastBinary.
+	binary bool
+	// json messages hold a JSON value rather than text, see BroadcastJSON.
+	json bool
+	// stream messages are live page updates sent with BroadcastStream; they
+	// go out as TypeStream envelopes, which clients can't publish.
+	stream bool
 }
 
 func InitPubSub() {
 	// Initialize the Hub with an empty channels map and channels for register, unregister, and broadcast.
 	// This function is called once at application startup.
 	slog.Info("Initializing Pub/Sub")
-	HUB = newHub(db.GetDB())
+	HUB = NewHub(db.GetDB())
+	if config.WS_COMPRESSION {
+		HUB.SetCompression(Compression{Enabled: true})
+	}
 	go HUB.Run()
+	HUB.StartPruner(DefaultPruneInterval)
+	if config.WS_BACKPLANE {
+		HUB.StartBackplane(DefaultBackplaneInterval)
+	}
+	models.BroadcastStream = broadcastModelStream
 }
 
-// NewHub initializes a new Hub.
-func newHub(db *gorm.DB) *Hub {
+// NewHub returns a hub that stores messages in db, or stores nothing if db is
+// nil. The application's hub is created by InitPubSub; create others for
+// tests (see ws/wstest) and start them with go h.Run().
+func NewHub(db *gorm.DB) *Hub {
 	return &Hub{
 		channels:   make(map[string]map[*Client]bool),
 		register:   make(chan Subscription, 256),
 		unregister: make(chan Subscription, 256),
 		broadcast:  make(chan BroadcastMessage, 256),
+		disconnect: make(chan *Client, 256),
 		db:         db,
+		presence:   newPresence(),
+		origin:     newOrigin(),
+		clients:    make(map[*Client]bool),
+		// Buffered so the backplane never waits for a busy hub loop.
+		backplaneStart: make(chan uint, 1),
+		backplanePoll:  make(chan struct{}, 1),
+		quit:           make(chan chan struct{}),
+		done:           make(chan struct{}),
 	}
 }
 
 // Broadcast enqueues a message to be sent to all clients subscribed to a channel.
 // It can be called from any goroutine.
+// Messages broadcast after Shutdown has finished are dropped.
+// The data is text: envelopes carry it as a JSON string. Use BroadcastJSON
+// to send a JSON value.
 func (h *Hub) Broadcast(channel string, data []byte) {
-	h.broadcast <- BroadcastMessage{channel: channel, data: data}
+	select {
+	case h.broadcast <- BroadcastMessage{channel: channel, data: data}:
+	case <-h.done:
+	}
+}
+
+// BroadcastJSON is Broadcast for a value that envelopes carry as JSON, e.g.
+// {"payload": {"title": "Build finished"}} for a struct or map. It returns
+// the error if v can't be encoded.
+func (h *Hub) BroadcastJSON(channel string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	select {
+	case h.broadcast <- BroadcastMessage{channel: channel, data: data, json: true}:
+	case <-h.done:
+	}
+	return nil
 }
 
 // Run starts the hub loop to process registrations, unregistrations, and broadcasts.
@@ -73,89 +187,211 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case sub := <-h.register:
-			h.mu.Lock()
-			if _, ok := h.channels[sub.channel]; !ok {
-				h.channels[sub.channel] = make(map[*Client]bool)
+			// A client that disconnected before its subscription was
+			// processed must not be added back, and no one subscribes once
+			// the hub is shutting down.
+			if sub.client.isClosed() || h.isStopping() {
+				continue
+			}
+			// Replay happens on the hub goroutine, before the client joins the
+			// channel, so no broadcast can slip in between the stored history
+			// and live delivery.
+			if sub.ack {
+				sub.client.notify(Envelope{Type: TypeSubscribed, Channel: sub.channel})
 			}
-			h.channels[sub.channel][sub.client] = true
-			sub.client.subscriptions[sub.channel] = true
+			h.replay(sub)
+			h.mu.Lock()
+			h.addSubscription(sub.client, sub.channel)
 			h.mu.Unlock()
+			if !isPattern(sub.channel) {
+				h.join(sub.channel, sub.client, sub.identity)
+			}
 			slog.Info("client subscribed", "channel", sub.channel)
 
 		case sub := <-h.unregister:
 			h.mu.Lock()
-			if clients, ok := h.channels[sub.channel]; ok {
-				if _, exists := clients[sub.client]; exists {
-					delete(clients, sub.client)
-					delete(sub.client.subscriptions, sub.channel)
-					if len(clients) == 0 {
-						delete(h.channels, sub.channel)
-					}
-				}
-			}
+			h.removeSubscription(sub.client, sub.channel)
 			h.mu.Unlock()
+			h.leave(sub.channel, sub.client)
+			if sub.ack {
+				sub.client.notify(Envelope{Type: TypeUnsubscribed, Channel: sub.channel})
+			}
 			slog.Info("client unsubscribed", "channel", sub.channel)
 
 		case msg := <-h.broadcast:
-			// Persist the message asynchronously to avoid blocking broadcasts.
-			go func(channel string, data []byte) {
-				record := models.Message{
-					Channel:   channel,
-					Content:   string(data),
-					CreatedAt: time.Now(),
-				}
-				if err := h.db.Create(&record).Error; err != nil {
-					slog.Error("DB error", "error", err)
-				}
-			}(msg.channel, msg.data)
-
-			// Snapshot clients subscribed to the channel.
-			h.mu.RLock()
-			var targets []*Client
-			if clients, ok := h.channels[msg.channel]; ok {
-				for c := range clients {
-					targets = append(targets, c)
-				}
-			}
-			h.mu.RUnlock()
-
-			// Send the message outside the lock for scalability.
-			for _, client := range targets {
+			// Persist messages before fanning them out. Doing this on the hub
+			// goroutine keeps the stored history and live delivery in the same
+			// order, which replay relies on. Broadcasts that queued up while
+			// the hub was busy are stored with a single insert.
+			batch := []BroadcastMessage{msg}
+		collect:
+			for len(batch) < persistBatch {
 				select {
-				case client.send <- msg.data:
+				case msg := <-h.broadcast:
+					batch = append(batch, msg)
 				default:
-					close(client.send)
-					h.mu.Lock()
-					delete(h.channels[msg.channel], client)
-					h.mu.Unlock()
+					break collect
 				}
 			}
+			h.persist(batch)
+			h.deliverInOrder(batch)
+
+		case last := <-h.backplaneStart:
+			h.backplane, h.remoteLast = true, last
+
+		case <-h.backplanePoll:
+			for _, msg := range h.pullRemote(0) {
+				h.deliver(msg)
+			}
+
+		case client := <-h.disconnect:
+			h.removeClient(client)
+
+		case key := <-h.presence.expired:
+			h.expire(key)
+
+		case flushed := <-h.quit:
+			h.drain()
+			close(flushed)
+
+		case <-h.done:
+			return
 		}
 	}
 }
 
+// deliver fans a broadcast out to the server-side listeners and subscribed
+// clients of its channel.
+func (h *Hub) deliver(msg BroadcastMessage) {
+	out := newFrames(msg)
+
+	h.notifyListeners(msg)
+	targets := h.subscribers(msg.channel)
+
+	// Send the message outside the lock for scalability. Clients
+	// disconnected by the slow consumer policy leave every channel, not just
+	// this one.
+	for _, client := range targets {
+		// Skip messages the client already got from its replay.
+		if msg.id != 0 && msg.id <= client.replayed[msg.channel] {
+			continue
+		}
+		if !client.queue(out.forClient(client)) {
+			h.removeClient(client)
+		}
+	}
+}
+
+// addSubscription adds client to channel, which may be a wildcard pattern.
+// The caller must hold h.mu.
+func (h *Hub) addSubscription(client *Client, channel string) {
+	client.subscriptions[channel] = true
+	if isPattern(channel) {
+		h.patterns.add(channel, client)
+		return
+	}
+	if _, ok := h.channels[channel]; !ok {
+		h.channels[channel] = make(map[*Client]bool)
+	}
+	h.channels[channel][client] = true
+}
+
+// removeSubscription removes client from channel, which may be a wildcard
+// pattern. The caller must hold h.mu.
+func (h *Hub) removeSubscription(client *Client, channel string) {
+	if !client.subscriptions[channel] {
+		return
+	}
+	delete(client.subscriptions, channel)
+	delete(client.replayed, channel)
+	if isPattern(channel) {
+		h.patterns.remove(channel, client)
+		return
+	}
+	if clients, ok := h.channels[channel]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.channels, channel)
+		}
+	}
+}
+
+// subscribers snapshots the clients that should receive a broadcast on
+// channel: those subscribed to it by name and those with a matching pattern.
+// A client matching several ways is listed once.
+func (h *Hub) subscribers(channel string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var targets []*Client
+	for c := range h.channels[channel] {
+		targets = append(targets, c)
+	}
+	seen := make(map[*Client]bool, len(targets))
+	for _, c := range targets {
+		seen[c] = true
+	}
+	h.patterns.match(channel, func(c *Client) {
+		if !seen[c] {
+			seen[c] = true
+			targets = append(targets, c)
+		}
+	})
+	return targets
+}
+
 // Client represents a websocket client.
+//
+// The hub owns a client's membership: subscriptions is only touched by the hub
+// goroutine (under h.mu), and a client leaves all of its channels at once when
+// it disconnects or is evicted. send is closed exactly once, by close, after
+// which queued frames are dropped.
 type Client struct {
 	hub           *Hub
 	conn          *websocket.Conn
-	send          chan []byte
+	send          chan Frame
 	subscriptions map[string]bool
+	// replayed holds, per channel, the ID of the last message sent to the
+	// client by its replay. Owned by the hub goroutine.
+	replayed map[string]uint
+	// mu guards closed and the close reason and serializes writes to send
+	// with closing it.
+	mu     sync.Mutex
+	closed bool
+	// closeCode and closeReason go in the close frame, see setCloseReason.
+	closeCode   int
+	closeReason string
+	// request is the HTTP request the connection was upgraded from. It gives
+	// authorizers access to the session.
+	request *http.Request
+	// legacy clients receive raw message data instead of envelopes. They opt
+	// in with /ws?format=raw.
+	legacy bool
+	// textOnly clients (SSE streams) can't receive binary frames and get
+	// binary messages base64-encoded instead.
+	textOnly bool
+	// identity is the logged in user behind the connection, if any.
+	identity string
+	// handled holds the server-side Channels whose Subscribed callback ran
+	// for this client. It is only used by the client's reading goroutine.
+	handled map[string]Channel
+	// ctx is cancelled when the connection goes away, which cancels the
+	// client's running calls. pending counts those calls.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending int32
+	// limiter enforces the hub's rate limits on the client's commands.
+	limiter *limiter
 }
 
 // readPump pumps messages from the websocket connection to the hub.
 func (c *Client) readPump() {
-	defer func() {
-		// Unregister all subscriptions on disconnect.
-		for channel := range c.subscriptions {
-			c.hub.unregister <- Subscription{
-				client:  c,
-				channel: channel,
-			}
-		}
-		c.conn.Close()
-	}()
+	c.start()
+	// Leave every channel on disconnect. The hub closes send, which makes
+	// writePump flush what is queued, send a close frame and close the
+	// connection.
+	defer c.stop()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(c.hub.maxMessageSize())
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -163,7 +399,7 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		messageType, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err,
 				websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
@@ -171,42 +407,143 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-
-		// The client is expected to send a JSON message with a command.
-		// Example:
-		//   {"command": "subscribe", "identifier": "ChatChannel"}
-		//   {"command": "message", "identifier": "ChatChannel", "data": "Hello, World!"}
-		var clientMsg struct {
-			Command    string `json:"command"`
-			Identifier string `json:"identifier"`
-			Data       string `json:"data"`
+		if !c.handle(message, messageType == websocket.BinaryMessage) {
+			break
 		}
-		if err := json.Unmarshal(message, &clientMsg); err != nil {
-			slog.Error("invalid message", "message", string(message))
-			continue
+	}
+}
+
+// start prepares the client to handle commands.
+func (c *Client) start() {
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.limiter = c.hub.newLimiter(c.identity)
+}
+
+// stop takes the client out of the hub once its connection has gone away.
+func (c *Client) stop() {
+	c.hub.leaveHub(c)
+	c.unsubscribedAll()
+	c.cancel()
+	c.limiter.stop()
+}
+
+// handle runs one command sent by the client, in a text frame or, with its
+// data, in a binary frame. It reports false when the client must be
+// disconnected.
+func (c *Client) handle(message []byte, binary bool) bool {
+	// A client over its rate limit is told why and disconnected; the error
+	// frame is written before the close frame.
+	if !c.limiter.allow() {
+		slog.Warn("websocket client rate limited", "identity", c.identity)
+		c.sendError("", "", errRateLimited)
+		return false
+	}
+
+	// The client is expected to send a JSON message with a command.
+	// Example:
+	//   {"command": "subscribe", "identifier": "ChatChannel"}
+	//   {"command": "subscribe", "identifier": "ChatChannel", "since": 42, "limit": 50}
+	//   {"command": "subscribe", "identifier": "ChatChannel", "identity": "Ada"}
+	//   {"command": "message", "identifier": "ChatChannel", "data": "Hello, World!"}
+	//   {"command": "message", "identifier": "ChatChannel", "data": "{\"text\": \"Hi\"}", "encoding": "json"}
+	//   {"command": "call", "identifier": "orders.total", "ref": "7", "data": "{\"id\": 42}", "timeout": 2000}
+	var clientMsg struct {
+		Command    string  `json:"command"`
+		Identifier string  `json:"identifier"`
+		Data       string  `json:"data"`
+		Since      *Cursor `json:"since"`
+		Limit      int     `json:"limit"`
+		Identity   string  `json:"identity"`
+		// Encoding is EncodingJSON when Data is a JSON value rather than
+		// text.
+		Encoding string `json:"encoding"`
+		// Ref and Timeout (in milliseconds) are only used by calls.
+		Ref     string `json:"ref"`
+		Timeout int    `json:"timeout"`
+	}
+	//
+	// Binary frames carry the command as a JSON header and the data after
+	// it, see binary.go.
+	header, data := message, []byte(nil)
+	if binary {
+		var ok bool
+		if header, data, ok = splitBinary(message); !ok {
+			slog.Error("binary message without header")
+			c.sendError("", "", errInvalidCommand)
+			return true
 		}
+	}
+	if err := json.Unmarshal(header, &clientMsg); err != nil {
+		slog.Error("invalid message", "message", string(header))
+		c.sendError("", "", errInvalidCommand)
+		return true
+	}
+	if !binary {
+		data = []byte(clientMsg.Data)
+	}
 
-		switch clientMsg.Command {
-		case "subscribe":
-			c.hub.register <- Subscription{
-				client:  c,
-				channel: clientMsg.Identifier,
-			}
-		case "unsubscribe":
-			c.hub.unregister <- Subscription{
-				client:  c,
-				channel: clientMsg.Identifier,
-			}
-		case "message":
-			broadcastMsg := BroadcastMessage{
-				channel: clientMsg.Identifier,
-				data:    []byte(clientMsg.Data),
+	switch clientMsg.Command {
+	case "subscribe":
+		if err := c.hub.authorize(c, clientMsg.Identifier, ActionSubscribe); err != nil {
+			c.reject(clientMsg.Command, clientMsg.Identifier, err)
+			return true
+		}
+		if err := c.subscribed(clientMsg.Identifier); err != nil {
+			c.reject(clientMsg.Command, clientMsg.Identifier, err)
+			return true
+		}
+		sub := Subscription{
+			client:  c,
+			channel: clientMsg.Identifier,
+			since:   clientMsg.Since,
+			limit:   clientMsg.Limit,
+			ack:     true,
+			// A logged in user is always shown as themselves; the
+			// identity parameter only names anonymous clients, as guests.
+			identity: c.identity,
+		}
+		if sub.identity == "" && clientMsg.Identity != "" {
+			sub.identity = GuestPrefix + clientMsg.Identity
+		}
+		c.hub.register <- sub
+	case "unsubscribe":
+		c.hub.unregister <- Subscription{
+			client:  c,
+			channel: clientMsg.Identifier,
+			ack:     true,
+		}
+		c.unsubscribed(clientMsg.Identifier)
+	case "message":
+		if err := c.hub.authorize(c, clientMsg.Identifier, ActionPublish); err != nil {
+			c.reject(clientMsg.Command, clientMsg.Identifier, err)
+			return true
+		}
+		isJSON := !binary && clientMsg.Encoding == EncodingJSON
+		if isJSON && !json.Valid(data) {
+			c.sendError(clientMsg.Command, clientMsg.Identifier, errInvalidJSON)
+			return true
+		}
+		if handled, err := c.received(clientMsg.Identifier, data, binary, isJSON); handled {
+			if err != nil {
+				c.sendError(clientMsg.Command, clientMsg.Identifier, err)
 			}
-			c.hub.broadcast <- broadcastMsg
-		default:
-			slog.Error("unknown command", "command", clientMsg.Command)
+			return true
+		}
+		broadcastMsg := BroadcastMessage{
+			channel: clientMsg.Identifier,
+			data:    data,
+			binary:  binary,
+			json:    isJSON,
 		}
+		c.hub.broadcast <- broadcastMsg
+	case "call":
+		c.call(clientMsg.Identifier, clientMsg.Ref, data,
+			time.Duration(clientMsg.Timeout)*time.Millisecond)
+	default:
+		slog.Error("unknown command", "command", clientMsg.Command)
+		c.sendError(clientMsg.Command, clientMsg.Identifier, errUnknownCommand)
 	}
+	return true
 }
 
 // writePump pumps messages from the hub to the websocket connection.
@@ -218,14 +555,23 @@ func (c *Client) writePump() {
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
+		case frame, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// The client was closed by the hub, evicted as a slow
+				// consumer, or the hub is shutting down.
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			messageType := websocket.TextMessage
+			if frame.Binary {
+				messageType = websocket.BinaryMessage
+			}
+			// Small frames are cheaper sent as they are.
+			if c.hub.compression.Enabled {
+				c.conn.EnableWriteCompression(len(frame.Data) >= c.hub.compressionThreshold())
+			}
+			if err := c.conn.WriteMessage(messageType, frame.Data); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -242,27 +588,61 @@ func (c *Client) writePump() {
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// Allow all origins for simplicity. In production, you should verify the origin.
+	// Only pages from this site, or from origins trusted on
+	// middleware.CrossOriginProtector(), may open a connection.
 	CheckOrigin: func(r *http.Request) bool {
-		return true
+		if middleware.CheckOrigin(r) {
+			return true
+		}
+		slog.Warn("websocket upgrade blocked by origin check", "origin", r.Header.Get("Origin"))
+		return false
 	},
 }
 
 // ServeWs is the handler for the /ws endpoint.
 // It upgrades the HTTP connection to a WebSocket and registers the client with the shared Hub.
 func ServeWs(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	HUB.ServeWs(w, r)
+}
+
+// ServeWs is ServeWs for a hub other than HUB.
+func (h *Hub) ServeWs(w http.ResponseWriter, r *http.Request) {
+	if h.isStopping() {
+		refuse(w)
+		return
+	}
+	u := upgrader
+	u.EnableCompression = h.compression.Enabled
+	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Upgrade error:", err)
 		return
 	}
+	if h.compression.Level != 0 {
+		if err := conn.SetCompressionLevel(h.compression.Level); err != nil {
+			slog.Error("invalid websocket compression level", "level", h.compression.Level, "error", err)
+		}
+	}
 	client := &Client{
-		hub:           HUB,
+		hub:           h,
 		conn:          conn,
-		send:          make(chan []byte, 256),
+		send:          make(chan Frame, 256),
 		subscriptions: make(map[string]bool),
+		request:       r,
+		legacy:        r.URL.Query().Get("format") == "raw",
+		identity:      Identify(r),
+	}
+	if !h.track(client, 2) {
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownReason))
+		conn.Close()
+		return
 	}
 	// Start writePump in a separate goroutine.
-	go client.writePump()
+	go func() {
+		defer h.pumps.Done()
+		client.writePump()
+	}()
+	defer h.pumps.Done()
 	client.readPump()
 }
@@ -1,15 +1,29 @@
 package ws
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"monolith/app/config"
 	"monolith/app/models"
+	"monolith/app/session"
 
 	"github.com/glebarez/sqlite"
+	"github.com/gorilla/websocket"
 	"gorm.io/gorm"
 )
 
+func TestMain(m *testing.M) {
+	// Clients look up their identity in the session, so the store must exist.
+	config.InitConfig()
+	session.InitSession()
+	os.Exit(m.Run())
+}
+
 func setupDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	if err != nil {
@@ -21,9 +35,23 @@ func setupDB(t *testing.T) *gorm.DB {
 	return db
 }
 
+// dial serves h over a test server and opens a WebSocket connection to it.
+func dial(t *testing.T, h *Hub) *websocket.Conn {
+	t.Helper()
+	HUB = h
+	srv := httptest.NewServer(http.HandlerFunc(ServeWs))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
 func TestBroadcastPersists(t *testing.T) {
 	db := setupDB(t)
-	h := newHub(db)
+	h := NewHub(db)
 	go h.Run()
 	h.Broadcast("ch", []byte("hello"))
 	time.Sleep(50 * time.Millisecond)
@@ -38,19 +66,23 @@ func TestBroadcastPersists(t *testing.T) {
 
 func TestSubscribeUnsubscribe(t *testing.T) {
 	db := setupDB(t)
-	h := newHub(db)
+	h := NewHub(db)
 	go h.Run()
-	c := &Client{hub: h, send: make(chan []byte, 1), subscriptions: make(map[string]bool)}
+	c := &Client{hub: h, send: make(chan Frame, 1), subscriptions: make(map[string]bool)}
 	h.register <- Subscription{client: c, channel: "room"}
 	time.Sleep(10 * time.Millisecond)
+	h.mu.RLock()
 	if !c.subscriptions["room"] {
 		t.Fatalf("client not subscribed")
 	}
 	if _, ok := h.channels["room"][c]; !ok {
 		t.Fatalf("hub missing client")
 	}
+	h.mu.RUnlock()
 	h.unregister <- Subscription{client: c, channel: "room"}
 	time.Sleep(10 * time.Millisecond)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if len(c.subscriptions) != 0 {
 		t.Fatalf("unsubscribe failed")
 	}
@@ -0,0 +1,419 @@
+/*
+Package wstest provides an isolated WebSocket hub and fake clients for testing
+channel logic, authorization and anything else built on package ws.
+
+	func TestChat(t *testing.T) {
+		h := wstest.NewHub(t, wstest.WithDB(), wstest.Configure(func(h *ws.Hub) {
+			h.HandleChannel("chat:{room}", &ChatChannel{})
+		}))
+		alice := h.Connect("alice@example.com")
+		bob := h.Connect("bob@example.com")
+		alice.Subscribe("chat:lobby")
+		bob.Subscribe("chat:lobby")
+
+		bob.Send("chat:lobby", "hi")
+		var got string
+		alice.ExpectPayload("chat:lobby", &got)
+	}
+
+Clients from Connect talk to the hub in-process through ws.LocalConn, so no
+network or upgrader is involved. Dial connects a real WebSocket through an
+httptest.Server instead, for code that depends on the handshake; identities
+are then read from the request's session like in the app, so the session store
+must be initialized (session.InitSession).
+*/
+package wstest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"monolith/app/models"
+	"monolith/ws"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// DefaultTimeout is how long a client waits for an expected frame.
+const DefaultTimeout = time.Second
+
+// Option configures a Hub made by NewHub.
+type Option func(*options)
+
+type options struct {
+	db        bool
+	configure []func(*ws.Hub)
+}
+
+// WithDB gives the hub a fresh in-memory database so messages are stored and
+// can be replayed. Without it nothing is stored.
+func WithDB() Option {
+	return func(o *options) { o.db = true }
+}
+
+// Configure runs fn on the hub before it starts, which is where handlers,
+// authorizers, limits and other startup settings belong.
+func Configure(fn func(h *ws.Hub)) Option {
+	return func(o *options) { o.configure = append(o.configure, fn) }
+}
+
+// Hub is a running ws.Hub private to one test. It is shut down when the test
+// ends.
+type Hub struct {
+	*ws.Hub
+	// DB is the hub's database, or nil without WithDB.
+	DB *gorm.DB
+
+	t      testing.TB
+	server *httptest.Server
+}
+
+// NewHub starts an isolated hub. It doesn't touch ws.HUB.
+func NewHub(t testing.TB, opts ...Option) *Hub {
+	t.Helper()
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	h := &Hub{t: t}
+	if o.db {
+		h.DB = openDB(t)
+	}
+	h.Hub = ws.NewHub(h.DB)
+	for _, fn := range o.configure {
+		fn(h.Hub)
+	}
+	go h.Run()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer cancel()
+		if err := h.Shutdown(ctx); err != nil {
+			t.Errorf("wstest: hub shutdown: %v", err)
+		}
+		if h.server != nil {
+			h.server.Close()
+		}
+	})
+	return h
+}
+
+func openDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("wstest: open db: %v", err)
+	}
+	// Every connection to ":memory:" is a database of its own.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("wstest: open db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Message{}); err != nil {
+		t.Fatalf("wstest: migrate: %v", err)
+	}
+	return db
+}
+
+// Connect opens an in-process client acting as identity, or anonymous if
+// identity is "".
+func (h *Hub) Connect(identity string) *Client {
+	h.t.Helper()
+	return h.ConnectRequest(nil, identity)
+}
+
+// ConnectRequest is Connect with r standing in for the upgrade request that
+// authorizers, Channels and calls see.
+func (h *Hub) ConnectRequest(r *http.Request, identity string) *Client {
+	h.t.Helper()
+	conn, err := h.ConnectLocal(r, identity)
+	if err != nil {
+		h.t.Fatalf("wstest: connect: %v", err)
+	}
+	c := &Client{
+		t:          h.t,
+		frames:     conn.Frames(),
+		send:       conn.Send,
+		sendBinary: conn.SendBinary,
+		close:      conn.Close,
+	}
+	h.t.Cleanup(c.Close)
+	return c
+}
+
+// Server returns a test server for the hub with its WebSocket endpoint at
+// /ws and its SSE endpoint at /events. It is started on first use and closed
+// when the test ends.
+func (h *Hub) Server() *httptest.Server {
+	if h.server == nil {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/ws", h.ServeWs)
+		mux.HandleFunc("/events", h.ServeSSE)
+		h.server = httptest.NewServer(mux)
+	}
+	return h.server
+}
+
+// Dial connects a client over a real WebSocket to Server. header is sent
+// with the handshake, e.g. a session cookie or an Origin.
+func (h *Hub) Dial(header http.Header) *Client {
+	h.t.Helper()
+	url := "ws" + strings.TrimPrefix(h.Server().URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		h.t.Fatalf("wstest: dial: %v", err)
+	}
+	// Reading on a goroutine of its own lets expectations time out without
+	// breaking the connection, which a read deadline would.
+	frames := make(chan ws.Frame, 256)
+	go func() {
+		defer close(frames)
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- ws.Frame{Data: data, Binary: messageType == websocket.BinaryMessage}
+		}
+	}()
+	c := &Client{
+		t:      h.t,
+		frames: frames,
+		send: func(command []byte) error {
+			return conn.WriteMessage(websocket.TextMessage, command)
+		},
+		sendBinary: func(message []byte) error {
+			return conn.WriteMessage(websocket.BinaryMessage, message)
+		},
+		close: func() { conn.Close() },
+	}
+	h.t.Cleanup(c.Close)
+	return c
+}
+
+// Client is a fake client connected to a Hub. Its methods fail the test when
+// the hub doesn't answer as expected within Timeout.
+type Client struct {
+	// Timeout is how long expectations wait for a frame. Zero means
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	t          testing.TB
+	frames     <-chan ws.Frame
+	send       func(command []byte) error
+	sendBinary func(message []byte) error
+	close      func()
+	// held keeps frames read while looking for a call's result, in order.
+	held []ws.Envelope
+	refs int
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Command sends a raw command, e.g.
+//
+//	c.Command(map[string]interface{}{"command": "subscribe", "identifier": "news", "since": 42})
+func (c *Client) Command(command interface{}) {
+	c.t.Helper()
+	data, err := json.Marshal(command)
+	if err != nil {
+		c.t.Fatalf("wstest: encode command: %v", err)
+	}
+	if err := c.send(data); err != nil {
+		c.t.Fatalf("wstest: send %s: %v", data, err)
+	}
+}
+
+// Subscribe subscribes to channel and waits for the confirmation.
+func (c *Client) Subscribe(channel string) {
+	c.t.Helper()
+	c.Command(map[string]string{"command": "subscribe", "identifier": channel})
+	c.Expect(ws.TypeSubscribed, channel)
+}
+
+// Unsubscribe leaves channel and waits for the confirmation.
+func (c *Client) Unsubscribe(channel string) {
+	c.t.Helper()
+	c.Command(map[string]string{"command": "unsubscribe", "identifier": channel})
+	c.Expect(ws.TypeUnsubscribed, channel)
+}
+
+// Send publishes data on channel.
+func (c *Client) Send(channel, data string) {
+	c.t.Helper()
+	c.Command(map[string]string{"command": "message", "identifier": channel, "data": data})
+}
+
+// SendJSON publishes v on channel as a JSON value.
+func (c *Client) SendJSON(channel string, v interface{}) {
+	c.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatalf("wstest: encode %v: %v", v, err)
+	}
+	c.Command(map[string]string{"command": "message", "identifier": channel, "data": string(data), "encoding": ws.EncodingJSON})
+}
+
+// SendBinary publishes data on channel in a binary frame.
+func (c *Client) SendBinary(channel string, data []byte) {
+	c.t.Helper()
+	header, err := json.Marshal(map[string]string{"command": "message", "identifier": channel})
+	if err != nil {
+		c.t.Fatalf("wstest: encode command: %v", err)
+	}
+	message := append(append(header, '\n'), data...)
+	if err := c.sendBinary(message); err != nil {
+		c.t.Fatalf("wstest: send binary to %s: %v", channel, err)
+	}
+}
+
+// Call calls method with data and returns the reply, a result or an error
+// frame. Other frames that arrive meanwhile are kept for Next.
+func (c *Client) Call(method, data string) ws.Envelope {
+	c.t.Helper()
+	c.refs++
+	ref := fmt.Sprintf("wstest-%d", c.refs)
+	c.Command(map[string]string{"command": "call", "identifier": method, "ref": ref, "data": data})
+	deadline := time.After(c.timeout())
+	for {
+		e, ok := c.read(deadline)
+		if !ok {
+			c.t.Fatalf("wstest: no reply to call %s", method)
+		}
+		if e.Ref == ref {
+			return e
+		}
+		c.held = append(c.held, e)
+	}
+}
+
+// Next returns the next frame. For a binary message, Encoding is
+// ws.EncodingBinary and Payload holds the raw bytes, which needn't be JSON.
+func (c *Client) Next() ws.Envelope {
+	c.t.Helper()
+	if len(c.held) > 0 {
+		e := c.held[0]
+		c.held = c.held[1:]
+		return e
+	}
+	e, ok := c.read(time.After(c.timeout()))
+	if !ok {
+		c.t.Fatalf("wstest: no frame within %v", c.timeout())
+	}
+	return e
+}
+
+// read waits for a frame until deadline. It reports false on timeout and
+// fails the test if the connection closes.
+func (c *Client) read(deadline <-chan time.Time) (ws.Envelope, bool) {
+	c.t.Helper()
+	select {
+	case frame, ok := <-c.frames:
+		if !ok {
+			c.t.Fatalf("wstest: connection closed")
+		}
+		header, data := frame.Data, []byte(nil)
+		if frame.Binary {
+			i := bytes.IndexByte(frame.Data, '\n')
+			if i < 0 {
+				c.t.Fatalf("wstest: binary frame without header")
+			}
+			header, data = frame.Data[:i], frame.Data[i+1:]
+		}
+		var e ws.Envelope
+		if err := json.Unmarshal(header, &e); err != nil {
+			c.t.Fatalf("wstest: invalid frame %s: %v", header, err)
+		}
+		if frame.Binary {
+			e.Payload = data
+		}
+		return e, true
+	case <-deadline:
+		return ws.Envelope{}, false
+	}
+}
+
+// Expect returns the next frame, failing the test unless it has type typ
+// (ws.TypeMessage, ws.TypeError, ...) and is about channel.
+func (c *Client) Expect(typ, channel string) ws.Envelope {
+	c.t.Helper()
+	e := c.Next()
+	if e.Type != typ || e.Channel != channel {
+		c.t.Fatalf("wstest: expected %s on %q, got %s on %q (error %q, payload %s)",
+			typ, channel, e.Type, e.Channel, e.Error, e.Payload)
+	}
+	return e
+}
+
+// ExpectMessage returns the next frame, which must be a message on channel.
+func (c *Client) ExpectMessage(channel string) ws.Envelope {
+	c.t.Helper()
+	return c.Expect(ws.TypeMessage, channel)
+}
+
+// ExpectPayload expects a message on channel and decodes its payload into v.
+func (c *Client) ExpectPayload(channel string, v interface{}) {
+	c.t.Helper()
+	e := c.ExpectMessage(channel)
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		c.t.Fatalf("wstest: decode payload %s: %v", e.Payload, err)
+	}
+}
+
+// ExpectError returns the next frame, which must be an error about channel.
+func (c *Client) ExpectError(channel string) ws.Envelope {
+	c.t.Helper()
+	return c.Expect(ws.TypeError, channel)
+}
+
+// ExpectNothing fails the test if a frame arrives within d.
+func (c *Client) ExpectNothing(d time.Duration) {
+	c.t.Helper()
+	if len(c.held) > 0 {
+		c.t.Fatalf("wstest: unexpected frame %+v", c.held[0])
+	}
+	select {
+	case frame, ok := <-c.frames:
+		if ok {
+			c.t.Fatalf("wstest: unexpected frame %s", frame.Data)
+		}
+		c.t.Fatalf("wstest: connection closed")
+	case <-time.After(d):
+	}
+}
+
+// ExpectClosed fails the test unless the hub closes the connection within
+// Timeout, without sending another frame first.
+func (c *Client) ExpectClosed() {
+	c.t.Helper()
+	if len(c.held) > 0 {
+		c.t.Fatalf("wstest: unexpected frame %+v", c.held[0])
+	}
+	select {
+	case frame, ok := <-c.frames:
+		if ok {
+			c.t.Fatalf("wstest: expected close, got frame %s", frame.Data)
+		}
+	case <-time.After(c.timeout()):
+		c.t.Fatalf("wstest: connection still open after %v", c.timeout())
+	}
+}
+
+// Close disconnects the client. It is called when the test ends.
+func (c *Client) Close() {
+	c.close()
+}
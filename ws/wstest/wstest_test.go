@@ -0,0 +1,122 @@
+package wstest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"monolith/app/config"
+	"monolith/app/session"
+	"monolith/ws"
+)
+
+func TestMain(m *testing.M) {
+	// Dial reads identities from the session like the app does.
+	config.InitConfig()
+	session.InitSession()
+	os.Exit(m.Run())
+}
+
+// upper broadcasts messages upper-cased and refuses empty ones.
+type upper struct{}
+
+func (upper) Subscribed(ctx *ws.Context) error { return nil }
+func (upper) Unsubscribed(ctx *ws.Context)     {}
+func (upper) Received(ctx *ws.Context, data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty message")
+	}
+	ctx.Broadcast([]byte(strings.ToUpper(string(data))))
+	return nil
+}
+
+func TestLocalClients(t *testing.T) {
+	h := NewHub(t, Configure(func(h *ws.Hub) {
+		h.HandleChannel("shout:*", upper{})
+	}))
+	alice := h.Connect("alice@example.com")
+	bob := h.Connect("")
+	alice.Subscribe("shout:lobby")
+	bob.Subscribe("shout:lobby")
+	// Bob is anonymous, so only Alice's own join is announced.
+	alice.Expect("join", "shout:lobby")
+
+	bob.Send("shout:lobby", "hi")
+	var got string
+	alice.ExpectPayload("shout:lobby", &got)
+	if got != "HI" {
+		t.Fatalf("expected HI, got %q", got)
+	}
+	bob.ExpectMessage("shout:lobby")
+
+	bob.Send("shout:lobby", "")
+	if e := bob.ExpectError("shout:lobby"); e.Error != "empty message" {
+		t.Fatalf("unexpected error %q", e.Error)
+	}
+	alice.ExpectNothing(50 * time.Millisecond)
+}
+
+func TestCallAndReplay(t *testing.T) {
+	h := NewHub(t, WithDB(), Configure(func(h *ws.Hub) {
+		h.HandleCall("whoami", func(ctx context.Context, call *ws.Call) (interface{}, error) {
+			return call.Identity, nil
+		})
+	}))
+	h.Broadcast("news", []byte("first"))
+	h.Broadcast("news", []byte("second"))
+
+	c := h.Connect("carol@example.com")
+	if e := c.Call("whoami", ""); e.Type != ws.TypeResult || string(e.Payload) != `"carol@example.com"` {
+		t.Fatalf("unexpected reply %+v", e)
+	}
+
+	c.Command(map[string]interface{}{"command": "subscribe", "identifier": "news", "limit": 1})
+	c.Expect(ws.TypeSubscribed, "news")
+	if e := c.ExpectMessage("news"); string(e.Payload) != `"second"` || e.ID == 0 {
+		t.Fatalf("expected the newest stored message, got %+v", e)
+	}
+}
+
+func TestRateLimitedClientClosed(t *testing.T) {
+	h := NewHub(t, Configure(func(h *ws.Hub) {
+		h.SetClientRateLimit(ws.RateLimit{PerSecond: 0.001, Burst: 1})
+	}))
+	c := h.Connect("")
+	c.Subscribe("news")
+	c.Command(map[string]string{"command": "unsubscribe", "identifier": "news"})
+	c.ExpectError("")
+	c.ExpectClosed()
+}
+
+func TestDial(t *testing.T) {
+	h := NewHub(t)
+	c := h.Dial(nil)
+	c.Subscribe("news")
+	h.Broadcast("news", []byte("over the wire"))
+	if e := c.ExpectMessage("news"); string(e.Payload) != `"over the wire"` {
+		t.Fatalf("unexpected message %+v", e)
+	}
+	c.SendJSON("news", map[string]int{"n": 1})
+	if e := c.ExpectMessage("news"); string(e.Payload) != `{"n":1}` {
+		t.Fatalf("unexpected JSON message %+v", e)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	h := NewHub(t)
+	alice := h.Connect("")
+	bob := h.Dial(nil)
+	alice.Subscribe("files")
+	bob.Subscribe("files")
+
+	bob.SendBinary("files", []byte{0, '\n', 1})
+	for _, c := range []*Client{alice, bob} {
+		e := c.ExpectMessage("files")
+		if e.Encoding != ws.EncodingBinary || string(e.Payload) != "\x00\n\x01" {
+			t.Fatalf("unexpected binary message %+v", e)
+		}
+	}
+}